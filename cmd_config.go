@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"tt6d/pkg/config"
+)
+
+// runConfig shows the effective configuration
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: tt6d config show [options]")
+		fmt.Println("Shows the settings in effect and where each comes from. Settings are read")
+		fmt.Println("from flags, then TT6D_* environment variables, then the selected profile,")
+		fmt.Printf("then the top of %s.\n", config.DefaultPath())
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("tt6d config show", flag.ExitOnError)
+	var dl downloadFlags
+	dl.register(fs)
+	var cfg configFlags
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d config show [options]")
+		fmt.Println("Shows the settings in effect. Any download option may be given to see how it combines.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+	if args = parseArgs(fs, args[1:]); len(args) > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if err := cfg.apply(fs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Catch bad values now rather than at the next download
+	concurrentDownloads, err := cfg.concurrency(dl.concurrent, nil, 0)
+	if err == nil {
+		_, _, err = dl.options(concurrentDownloads)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	path := config.DefaultPath()
+	if _, err := os.Stat(path); err != nil {
+		path += " (not found)"
+	}
+	fmt.Printf("Config file: %s\n", path)
+	fmt.Printf("Profile: %s\n\n", orDash(cfg.profile))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range config.Settings {
+		value, source := settingSource(fs, &cfg, s)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, orDash(value), source)
+	}
+	tw.Flush()
+}
+
+// settingSource returns the effective value of a setting and where it came from
+func settingSource(fs *flag.FlagSet, cfg *configFlags, s config.Setting) (string, string) {
+	var fl *flag.Flag
+	if s.Flag != "" {
+		fl = fs.Lookup(s.Flag)
+	}
+	v, fromConfig := cfg.values[s.Key]
+	switch {
+	case fl != nil && cfg.given[s.Flag]:
+		return fl.Value.String(), "flag --" + s.Flag
+	case fl != nil && fromConfig:
+		return fl.Value.String(), v.Source
+	case fromConfig:
+		return v.Value, v.Source
+	case fl != nil:
+		return fl.DefValue, "default"
+	}
+	return "", "default"
+}
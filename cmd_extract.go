@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tt6d/pkg/extractor"
+)
+
+// runExtract runs the extractor on a saved page without fetching anything
+func runExtract(args []string) {
+	fs := flag.NewFlagSet("tt6d extract", flag.ExitOnError)
+	htmlPath := fs.String("html", "", "saved page to read, or - for stdin")
+	baseURL := fs.String("base-url", "", "URL the page was saved from; picks the provider and resolves relative links (without it every built-in and rules provider is tried)")
+	format := fs.String("format", "tree", "output format: tree or json")
+	asJSON := fs.Bool("json", false, "same as --format json")
+	rulesPath := fs.String("rules", "", "extraction rules file (default: "+extractor.DefaultRulesPath()+" if present)")
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d extract --html <file|-> [options]")
+		fmt.Println("Shows what the extractor finds on a saved page.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	if args = parseArgs(fs, args); len(args) > 0 || *htmlPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *asJSON {
+		*format = "json"
+	}
+	if *format != "tree" && *format != "json" {
+		fmt.Printf("Error: unknown format %q (use tree or json)\n", *format)
+		os.Exit(1)
+	}
+
+	body, err := readInput(*htmlPath)
+	if err != nil {
+		fmt.Printf("Error reading page: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := loadRules(*rulesPath); err != nil {
+		fmt.Printf("Error loading rules: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	// Keep stdout for the result
+	extractor.Messages = io.Discard
+	// Plugins are external programs; without a URL to match they would all
+	// be run on the page, so they are only asked about the site it came from
+	if *baseURL != "" {
+		for _, err := range extractor.RegisterPlugins(ctx, extractor.DefaultPluginDir()) {
+			fmt.Fprintf(os.Stderr, "Warning: skipping plugin %v\n", err)
+		}
+	}
+
+	links, info, err := extractor.ExtractPage(ctx, &extractor.Page{URL: *baseURL, Body: string(body)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error extracting content: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc := newPageDocument(*baseURL, links, info)
+	if *format == "json" {
+		if err := writeJSON(os.Stdout, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printTree(os.Stdout, doc)
+}
+
+// readInput reads a file, or stdin for "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
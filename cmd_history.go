@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tt6d/pkg/extractor"
+	"tt6d/pkg/history"
+)
+
+// historyDocument is the JSON form of tt6d history, versioned like
+// pageDocument
+type historyDocument struct {
+	Version int             `json:"version"`
+	Entries []history.Entry `json:"entries"`
+}
+
+// runHistory prints the downloads recorded in the history
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("tt6d history", flag.ExitOnError)
+	series := fs.String("series", "", "only downloads of series whose title contains this")
+	episode := fs.String("episode", "", "only this episode, e.g. S01E02")
+	link := fs.String("url", "", "only downloads whose link or page contains this")
+	since := fs.String("since", "", "only downloads since a date (2006-01-02) or for a duration (48h)")
+	limit := fs.Int("limit", 0, "show only the newest N downloads (0 for all)")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d history [options]")
+		fmt.Printf("Lists earlier downloads, recorded in %s\n", history.DefaultPath())
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	if args = parseArgs(fs, args); len(args) > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	filter := history.Filter{Series: *series, URL: *link, Episode: *episode}
+	if *episode != "" {
+		n, ok := extractor.ParseEpisodeID(*episode)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid episode %q (use the S01E02 form)\n", *episode)
+			os.Exit(1)
+		}
+		filter.Episode = n.String()
+	}
+	if *since != "" {
+		t, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		filter.Since = t
+	}
+
+	db, err := history.Open(history.DefaultPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	entries := db.Find(filter)
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	if *asJSON {
+		doc := historyDocument{Version: documentVersion, Entries: append([]history.Entry{}, entries...)}
+		if err := writeJSON(os.Stdout, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No downloads recorded")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tSERIES\tEPISODE\tSIZE\tPATH")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format("2006-01-02 15:04"), orDash(e.Series), orDash(e.EpisodeID), extractor.FormatSize(e.Size), e.Path)
+	}
+	tw.Flush()
+}
+
+// parseSince reads a date, a date and time, or a duration back from now
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (use a date such as 2006-01-02 or a duration such as 48h)", s)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tt6d/pkg/extractor"
+)
+
+// runList prints what a page offers without the interactive selector
+func runList(args []string) {
+	fs := flag.NewFlagSet("tt6d list", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table, tree or json")
+	asJSON := fs.Bool("json", false, "same as --format json")
+	rulesPath := fs.String("rules", "", "extraction rules file (default: "+extractor.DefaultRulesPath()+" if present)")
+	var cfg configFlags
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d list [options] <webpage_url>")
+		fmt.Println("Lists the seasons, episodes and links found on a page.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := cfg.apply(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	pageURL := args[0]
+	if *asJSON {
+		*format = "json"
+	}
+	switch *format {
+	case "table", "tree", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use table, tree or json)\n", *format)
+		os.Exit(1)
+	}
+
+	if err := loadRules(*rulesPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading rules: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := signalContext()
+	// Keep stdout for the result
+	extractor.Messages = io.Discard
+	for _, err := range extractor.RegisterPlugins(ctx, extractor.DefaultPluginDir()) {
+		fmt.Fprintf(os.Stderr, "Warning: skipping plugin %v\n", err)
+	}
+
+	links, info, err := extractor.ExtractContent(ctx, pageURL)
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error extracting content: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc := newPageDocument(pageURL, links, info)
+	switch *format {
+	case "json":
+		err = writeJSON(os.Stdout, doc)
+	case "tree":
+		printTree(os.Stdout, doc)
+	default:
+		err = printTable(os.Stdout, doc)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
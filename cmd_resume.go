@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tt6d/pkg/downloader"
+)
+
+// runResume continues the unfinished jobs recorded in a download folder's journal
+func runResume(args []string) {
+	fs := flag.NewFlagSet("tt6d resume", flag.ExitOnError)
+	var dl downloadFlags
+	dl.register(fs)
+	var cfg configFlags
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d resume [options] [download_folder] [concurrent_downloads]")
+		fmt.Println("Continues the unfinished downloads recorded in the folder's journal.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	args = parseArgs(fs, args)
+	if len(args) > 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := cfg.apply(fs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	downloadFolder, ok := cfg.downloadFolder(args, 0)
+	if !ok {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	concurrentDownloads, err := cfg.concurrency(dl.concurrent, args, 1)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts, _, err := dl.options(concurrentDownloads)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	journal, err := downloader.OpenJournal(downloadFolder)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	jobs := journal.Unfinished()
+	if len(jobs) == 0 {
+		fmt.Println("Nothing to resume")
+		return
+	}
+	fmt.Printf("Resuming %d unfinished downloads\n", len(jobs))
+
+	// Plugins may be needed to resolve the recorded links
+	ctx := signalContext()
+	loadPlugins(ctx)
+	opts = withHistory(opts, openHistory())
+
+	runDownloads(ctx, jobs, downloadFolder, opts)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"tt6d/pkg/extractor"
+)
+
+// runRules handles the rules subcommands
+func runRules(args []string) {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Println("Usage: tt6d rules test [options] <rules_file> <saved_page.html>")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("tt6d rules test", flag.ExitOnError)
+	pageURL := fs.String("url", "", "URL the page was saved from; resolves relative links and picks the matching site")
+	site := fs.String("site", "", "only test the site with this name")
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d rules test [options] <rules_file> <saved_page.html>")
+		fmt.Println("Shows what each site in the rules file extracts from a saved page.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	args = parseArgs(fs, args[1:])
+	if len(args) < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	providers, err := extractor.LoadRules(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	body, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Printf("Error reading page: %v\n", err)
+		os.Exit(1)
+	}
+
+	tested := 0
+	for _, p := range providers {
+		if *site != "" && p.Name != *site {
+			continue
+		}
+		if *pageURL != "" && !p.Match(*pageURL) {
+			fmt.Printf("Site %s: skipped, %s is not on %s\n\n", p.Name, *pageURL, strings.Join(p.Domains, ", "))
+			continue
+		}
+		tested++
+		if err := testRules(p, *pageURL, string(body)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if tested == 0 {
+		fmt.Println("No site in the rules file was tested")
+		os.Exit(1)
+	}
+}
+
+// testRules prints what one site's rules find on a page
+func testRules(p *extractor.RulesProvider, pageURL, body string) error {
+	result, err := p.Apply(body)
+	if err != nil {
+		return err
+	}
+
+	base, _ := url.Parse(pageURL)
+	fmt.Printf("Site %s (%s, priority %d)\n", p.Name, strings.Join(p.Domains, ", "), p.Priority)
+	fmt.Printf("  Title:   %s\n", orNone(result.Title))
+	fmt.Printf("  Seasons: %s\n", orNone(strings.Join(result.Seasons, ", ")))
+	fmt.Printf("  Rows:    %d\n", len(result.Rows))
+	for i, row := range result.Rows {
+		id := row.ID
+		if id == "" {
+			id = "(no episode ID)"
+		}
+		fmt.Printf("  %3d. %s", i+1, id)
+		if row.RawID != "" && row.RawID != row.ID {
+			fmt.Printf("  [%s]", row.RawID)
+		}
+		if row.Title != "" {
+			fmt.Printf("  %q", row.Title)
+		}
+		if row.Size != "" {
+			fmt.Printf("  size %s", row.Size)
+		}
+		if row.Quality != "" {
+			fmt.Printf("  %s", row.Quality)
+		}
+		fmt.Println()
+		if len(row.Links) == 0 {
+			fmt.Println("       (no links)")
+		}
+		for _, link := range row.Links {
+			if ref, err := url.Parse(link); err == nil && base != nil {
+				link = base.ResolveReference(ref).String()
+			}
+			fmt.Printf("       %s\n", link)
+		}
+	}
+
+	info, err := p.Extract(context.Background(), &extractor.Page{URL: pageURL, Body: body})
+	if err != nil {
+		fmt.Printf("  Result:  %v\n\n", err)
+		return nil
+	}
+	episodes, links := 0, 0
+	for _, eps := range info.Seasons {
+		episodes += len(eps)
+		for _, ep := range eps {
+			links += len(ep.Links)
+		}
+	}
+	fmt.Printf("  Result:  %d seasons, %d episodes, %d links\n\n", len(info.Seasons), episodes, links)
+	return nil
+}
+
+// loadRules registers the sites in a rules file. Without a path the default
+// rules file is loaded if it exists.
+func loadRules(path string) error {
+	if path == "" {
+		path = extractor.DefaultRulesPath()
+		if path == "" {
+			return nil
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+	return extractor.RegisterRules(path)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tt6d/pkg/downloader"
+	"tt6d/pkg/extractor"
+	"tt6d/pkg/history"
+	"tt6d/pkg/watch"
+)
+
+// runWatch manages followed series and downloads their new episodes
+func runWatch(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			runWatchAdd(args[1:])
+			return
+		case "remove":
+			runWatchRemove(args[1:])
+			return
+		case "list":
+			runWatchList(args[1:])
+			return
+		case "run":
+			runWatchRun(args[1:])
+			return
+		}
+	}
+	fmt.Println("Usage: tt6d watch add [options] <webpage_url> [download_folder]")
+	fmt.Println("       tt6d watch remove <webpage_url>")
+	fmt.Println("       tt6d watch list")
+	fmt.Println("       tt6d watch run [options]")
+	fmt.Println("Follows series pages and downloads new episodes as they appear.")
+	fmt.Printf("Subscriptions are kept in %s\n", watch.DefaultStatePath())
+	os.Exit(1)
+}
+
+// loadWatchState opens the subscription list or exits
+func loadWatchState() *watch.State {
+	state, err := watch.Load(watch.DefaultStatePath())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return state
+}
+
+// runWatchAdd subscribes to a series page. The episodes already on the page
+// count as seen unless --backfill is given.
+func runWatchAdd(args []string) {
+	fs := flag.NewFlagSet("tt6d watch add", flag.ExitOnError)
+	backfill := fs.Bool("backfill", false, "also download the episodes already on the page on the next run")
+	rulesPath := fs.String("rules", "", "extraction rules file (default: "+extractor.DefaultRulesPath()+" if present)")
+	var cfg configFlags
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d watch add [options] <webpage_url> [download_folder]")
+		fmt.Println("Follows a series page. New episodes are downloaded into the folder")
+		fmt.Println("(default: download_folder from the config file, or the current folder)")
+		fmt.Println("by tt6d watch run.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	args = parseArgs(fs, args)
+	if len(args) < 1 || len(args) > 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := cfg.apply(fs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	pageURL := args[0]
+	folder, ok := cfg.downloadFolder(args, 1)
+	if !ok {
+		folder = "."
+	}
+	// The watcher may run from anywhere
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	state := loadWatchState()
+	if state.Find(pageURL) != nil {
+		fmt.Printf("Already watching %s\n", pageURL)
+		return
+	}
+
+	if err := loadRules(*rulesPath); err != nil {
+		fmt.Printf("Error loading rules: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := signalContext()
+	loadPlugins(ctx)
+
+	fmt.Printf("Fetching page: %s\n", pageURL)
+	_, info, err := extractor.ExtractContent(ctx, pageURL)
+	if ctx.Err() != nil {
+		fmt.Println("Cancelled")
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Printf("Error extracting content: %v\n", err)
+		os.Exit(1)
+	}
+	if info == nil {
+		fmt.Println("Error: the page has no seasons or episodes to watch")
+		os.Exit(1)
+	}
+
+	sub := &watch.Subscription{URL: pageURL, Folder: folder, Title: info.Title}
+	if !*backfill {
+		sub.MarkKnown(watch.KnownIDs(info)...)
+	}
+	err = watch.Update(watch.DefaultStatePath(), func(state *watch.State) error {
+		return state.Add(sub)
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *backfill {
+		fmt.Printf("Watching %s; the next run downloads the %d episodes on the page\n", info.Title, len(sub.NewEpisodes(info)))
+	} else {
+		fmt.Printf("Watching %s; %d episodes on the page are already known\n", info.Title, len(sub.Known))
+	}
+}
+
+// runWatchRemove stops following a series page
+func runWatchRemove(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: tt6d watch remove <webpage_url>")
+		os.Exit(1)
+	}
+	err := watch.Update(watch.DefaultStatePath(), func(state *watch.State) error {
+		if !state.Remove(args[0]) {
+			return fmt.Errorf("not watching %s", args[0])
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Stopped watching %s\n", args[0])
+}
+
+// runWatchList prints the followed series
+func runWatchList(args []string) {
+	if len(args) != 0 {
+		fmt.Println("Usage: tt6d watch list")
+		os.Exit(1)
+	}
+	state := loadWatchState()
+	if len(state.Subscriptions) == 0 {
+		fmt.Println("Not watching any series")
+		return
+	}
+	for _, sub := range state.Subscriptions {
+		checked := "never checked"
+		if !sub.Checked.IsZero() {
+			checked = "checked " + sub.Checked.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s (%d known episodes, %s)\n  %s\n  → %s\n", orDash(sub.Title), len(sub.Known), checked, sub.URL, sub.Folder)
+	}
+}
+
+// runWatchRun checks every followed series and downloads new episodes,
+// once or every --interval
+func runWatchRun(args []string) {
+	fs := flag.NewFlagSet("tt6d watch run", flag.ExitOnError)
+	var dl downloadFlags
+	dl.register(fs)
+	once := fs.Bool("once", false, "check once and exit (for cron); exits with status 1 if anything failed")
+	interval := fs.Duration("interval", 6*time.Hour, "time between checks")
+	rulesPath := fs.String("rules", "", "extraction rules file (default: "+extractor.DefaultRulesPath()+" if present)")
+	var cfg configFlags
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tt6d watch run [options]")
+		fmt.Println("Downloads the new episodes of every followed series.")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+
+	if args = parseArgs(fs, args); len(args) > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := cfg.apply(fs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *interval < time.Minute {
+		fmt.Println("Error: --interval must be at least 1m")
+		os.Exit(1)
+	}
+	concurrentDownloads, err := cfg.concurrency(dl.concurrent, nil, 0)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts, mediaLayout, err := dl.options(concurrentDownloads)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.Quality == "ask" {
+		fmt.Println("Error: --quality ask needs someone to answer; pick a quality for watch run")
+		os.Exit(1)
+	}
+
+	if err := loadRules(*rulesPath); err != nil {
+		fmt.Printf("Error loading rules: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := signalContext()
+	loadPlugins(ctx)
+	watchRateSignals(opts.Limiter, opts.ConcurrentDownloads+1)
+	db := openHistory()
+	opts = withHistory(opts, db)
+
+	for {
+		ok := checkSubscriptions(ctx, db, opts, mediaLayout)
+		if ctx.Err() != nil {
+			fmt.Println("Cancelled")
+			os.Exit(130)
+		}
+		if *once {
+			if !ok {
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Printf("Next check at %s\n", time.Now().Add(*interval).Format("15:04"))
+		select {
+		case <-ctx.Done():
+			fmt.Println("Cancelled")
+			os.Exit(130)
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// checkSubscriptions downloads the new episodes of every followed series and
+// reports whether everything went well. The state is read again on every
+// check so series added in the meantime are included, and every result is
+// merged into the file as it is then, so series added or removed during a
+// check are kept that way.
+func checkSubscriptions(ctx context.Context, db *history.DB, opts downloader.Options, mediaLayout bool) bool {
+	path := watch.DefaultStatePath()
+	state, err := watch.Load(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+	if len(state.Subscriptions) == 0 {
+		fmt.Println("Not watching any series; add one with tt6d watch add <webpage_url>")
+		return true
+	}
+
+	ok := true
+	for _, sub := range state.Subscriptions {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := checkSubscription(ctx, db, sub, opts, mediaLayout); err != nil {
+			fmt.Printf("Error: %s: %v\n", orDash(sub.Title), err)
+			ok = false
+		}
+		// Save after every series so an interrupted run keeps what finished
+		err := watch.Update(path, func(current *watch.State) error {
+			current.Merge(sub)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+	}
+	return ok
+}
+
+// checkSubscription fetches one series page and downloads the episodes not
+// seen before. Episodes are only marked as seen once they are downloaded,
+// so failures are tried again on the next check. Episodes in the download
+// history are marked as seen without downloading them again.
+func checkSubscription(ctx context.Context, db *history.DB, sub *watch.Subscription, opts downloader.Options, mediaLayout bool) error {
+	fmt.Printf("Checking %s\n", sub.URL)
+	_, info, err := extractor.ExtractContent(ctx, sub.URL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch page: %v", err)
+	}
+	if info == nil {
+		return fmt.Errorf("the page no longer lists any episodes")
+	}
+	sub.Title = info.Title
+	sub.Checked = time.Now()
+
+	var episodes []extractor.Episode
+	for _, ep := range sub.NewEpisodes(info) {
+		if entry, ok := db.Episode(info.Title, ep.ID); ok {
+			fmt.Printf("Skipping %s: downloaded on %s to %s\n", ep.ID, entry.Time.Format("2006-01-02"), entry.Path)
+			sub.MarkKnown(ep.ID)
+			continue
+		}
+		episodes = append(episodes, ep)
+	}
+	if len(episodes) == 0 {
+		fmt.Printf("No new episodes of %s\n", info.Title)
+		return nil
+	}
+	fmt.Printf("Found %d new episodes of %s\n", len(episodes), info.Title)
+
+	if err := os.MkdirAll(sub.Folder, 0755); err != nil {
+		return fmt.Errorf("failed to create download folder: %v", err)
+	}
+	if mediaLayout {
+		if err := writeSeriesMetadata(ctx, info, sub.Folder, opts.Template); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	var jobs []downloader.Job
+	episodeIDs := make(map[string]string)
+	for _, ep := range episodes {
+		job := episodeJob(sub.URL, info, ep)
+		jobs = append(jobs, job)
+		episodeIDs[job.URL] = ep.ID
+	}
+
+	journal, err := downloader.OpenJournal(sub.Folder)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	opts.Journal = journal
+	summary, err := downloader.Download(ctx, jobs, sub.Folder, opts)
+	if summary != nil {
+		for _, link := range append(summary.Completed, summary.Skipped...) {
+			sub.MarkKnown(episodeIDs[link])
+		}
+		summary.Print()
+	}
+	if err != nil {
+		return err
+	}
+	if summary != nil && len(summary.Failed) > 0 {
+		return fmt.Errorf("%d episodes failed and will be tried again on the next check", len(summary.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"tt6d/pkg/config"
+	"tt6d/pkg/dash"
+	"tt6d/pkg/downloader"
+	"tt6d/pkg/extractor"
+	"tt6d/pkg/history"
+	"tt6d/pkg/hls"
+	"tt6d/pkg/ratelimit"
+	"tt6d/pkg/selection"
+	"tt6d/pkg/ui"
+)
+
+// downloadFlags are the options shared by every command that downloads
+type downloadFlags struct {
+	concurrent     int
+	connections    int
+	retry          downloader.RetryPolicy
+	onExisting     string
+	layout         string
+	nameTemplate   string
+	discardPartial bool
+	limitRate      string
+	quality        string
+}
+
+// register adds the download options to a flag set
+func (f *downloadFlags) register(fs *flag.FlagSet) {
+	f.retry = downloader.DefaultRetryPolicy()
+	fs.IntVar(&f.concurrent, "concurrent", 1, "files downloaded at the same time")
+	fs.IntVar(&f.connections, "connections", 1, "parallel connections per file (splits each file into byte ranges)")
+	fs.IntVar(&f.retry.MaxAttempts, "retries", f.retry.MaxAttempts, "maximum download attempts per file")
+	fs.DurationVar(&f.retry.BaseDelay, "retry-delay", f.retry.BaseDelay, "initial delay between attempts, doubled after each failure")
+	fs.DurationVar(&f.retry.MaxDelay, "retry-max-delay", f.retry.MaxDelay, "maximum delay between attempts")
+	fs.DurationVar(&f.retry.StallTimeout, "stall-timeout", f.retry.StallTimeout, "abort an attempt if no data arrives for this long (0 disables)")
+	fs.StringVar(&f.onExisting, "on-existing", string(downloader.PolicySkip), "what to do with files that already exist: skip, overwrite, rename or resume")
+	fs.StringVar(&f.layout, "layout", "flat", "output layout: flat, or jellyfin for Series/Season 01/ folders with NFO files and poster")
+	fs.StringVar(&f.nameTemplate, "template", "", "output path template for episodes, e.g. \"{series}/Season {season:02}/{series} - S{season:02}E{episode:02}.{ext}\"")
+	fs.BoolVar(&f.discardPartial, "discard-partial", false, "delete unfinished files when cancelled instead of keeping them for resume")
+	fs.StringVar(&f.limitRate, "limit-rate", "", "total bandwidth limit across all downloads, e.g. 500K or 2M")
+	fs.StringVar(&f.quality, "quality", "best", "HLS/DASH stream quality: best, worst, a height like 720p, a bandwidth in bits/s, or ask")
+}
+
+// selectFlags choose what to download without the interactive selector
+type selectFlags struct {
+	all        bool
+	seasons    string
+	episodes   string
+	latest     bool
+	match      string
+	redownload bool
+}
+
+// register adds the selection options to a flag set
+func (f *selectFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.all, "all", false, "download every episode or link without asking")
+	fs.StringVar(&f.seasons, "season", "", "download whole seasons without asking, e.g. 2 or 1,3 (0 or specials for specials)")
+	fs.StringVar(&f.episodes, "episodes", "", "download these episodes without asking, e.g. S01-S03, S02E04-, S05E01,S05E03..S05E06, latest:3 or !S01E02")
+	fs.BoolVar(&f.latest, "latest", false, "download only the newest available episode (of the selected seasons, if given)")
+	fs.StringVar(&f.match, "match", "", "download only links, or episodes with an ID, title or link, matching this regular expression")
+	fs.BoolVar(&f.redownload, "redownload", false, "with the options above, also download what the download history has, even if it was moved")
+}
+
+// criteria validates the selection flags
+func (f *selectFlags) criteria() (selection.Criteria, error) {
+	c := selection.Criteria{All: f.all, Latest: f.latest}
+	if f.episodes != "" {
+		filter, err := selection.Parse(f.episodes)
+		if err != nil {
+			return c, fmt.Errorf("invalid --episodes: %w", err)
+		}
+		c.Episodes = filter
+	}
+	if f.seasons != "" {
+		seasons, err := selection.ParseSeasons(f.seasons)
+		if err != nil {
+			return c, err
+		}
+		c.Seasons = seasons
+	}
+	if f.match != "" {
+		re, err := regexp.Compile(f.match)
+		if err != nil {
+			return c, fmt.Errorf("invalid --match expression: %v", err)
+		}
+		c.Match = re
+	}
+	return c, nil
+}
+
+// options validates the flags and builds downloader options.
+// mediaLayout reports whether NFO files should be written.
+func (f *downloadFlags) options(concurrentDownloads int) (opts downloader.Options, mediaLayout bool, err error) {
+	rate, err := ratelimit.ParseRate(f.limitRate)
+	if err != nil {
+		return opts, false, err
+	}
+
+	policy, err := downloader.ParsePolicy(f.onExisting)
+	if err != nil {
+		return opts, false, err
+	}
+
+	nameTemplate := f.nameTemplate
+	switch f.layout {
+	case "flat":
+	case "jellyfin", "kodi", "plex":
+		mediaLayout = true
+		if nameTemplate == "" {
+			nameTemplate = mediaServerTemplate
+		}
+	default:
+		return opts, false, fmt.Errorf("unknown layout %q (use flat or jellyfin)", f.layout)
+	}
+
+	if f.quality != "ask" {
+		if err := hls.ValidateQuality(f.quality); err != nil {
+			return opts, false, err
+		}
+	}
+
+	var tmpl *downloader.Template
+	if nameTemplate != "" {
+		if tmpl, err = downloader.ParseTemplate(nameTemplate); err != nil {
+			return opts, false, err
+		}
+	}
+	// The series metadata goes in the folder the template puts episodes in
+	if _, ok := tmpl.SeriesFolder("Series"); mediaLayout && !ok {
+		return opts, false, fmt.Errorf("--layout %s needs a --template that gives each series its own folder, such as {series}/Season {season:02}/...", f.layout)
+	}
+
+	opts = downloader.Options{
+		ConcurrentDownloads: concurrentDownloads,
+		Connections:         f.connections,
+		Retry:               f.retry,
+		Limiter:             ratelimit.New(rate),
+		DiscardPartial:      f.discardPartial,
+		OnExisting:          policy,
+		Template:            tmpl,
+		Quality:             f.quality,
+		Resolve:             extractor.Resolve,
+	}
+	if mediaLayout {
+		opts.OnComplete = func(job downloader.Job, filePath string) {
+			// Not fatal: the video itself is already in place
+			if err := writeEpisodeNFO(job, filePath); err != nil {
+				fmt.Printf("\nWarning: %v\n", err)
+			}
+		}
+	}
+	return opts, mediaLayout, nil
+}
+
+// configFlags pick a profile from the config file and set the options that
+// apply to every request
+type configFlags struct {
+	profile   string
+	proxy     string
+	userAgent string
+	theme     string
+
+	given  map[string]bool         // flags given on the command line
+	values map[string]config.Value // settings from the environment and the file
+}
+
+// register adds the config options to a flag set
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.profile, "profile", "", "profile from the config file to use (default: $TT6D_PROFILE)")
+	fs.StringVar(&f.proxy, "proxy", "", "HTTP or SOCKS5 proxy for every request, e.g. socks5://127.0.0.1:1080")
+	fs.StringVar(&f.userAgent, "user-agent", "", "User-Agent header sent with every request")
+	fs.StringVar(&f.theme, "theme", "default", "selector colours: default, light or mono")
+}
+
+// apply fills in the flags that were not given from the environment, the
+// profile and the config file, in that order, then sets up the network and
+// the theme. It is called after the flags are parsed.
+func (f *configFlags) apply(fs *flag.FlagSet) error {
+	profile := f.profile
+	if profile == "" {
+		profile = os.Getenv("TT6D_PROFILE")
+	}
+	file, err := config.Load(config.DefaultPath())
+	if err != nil {
+		return err
+	}
+	if f.values, err = file.Resolve(profile); err != nil {
+		return err
+	}
+	f.profile = profile
+
+	f.given = make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) {
+		f.given[fl.Name] = true
+	})
+	for _, s := range config.Settings {
+		v, ok := f.values[s.Key]
+		if !ok || s.Flag == "" || f.given[s.Flag] || fs.Lookup(s.Flag) == nil {
+			continue
+		}
+		if err := fs.Set(s.Flag, v.Value); err != nil {
+			return fmt.Errorf("invalid %s %q from %s: %v", s.Key, v.Value, v.Source, err)
+		}
+	}
+
+	if err := ui.SetTheme(f.theme); err != nil {
+		return err
+	}
+	return configureHTTP(f.proxy, f.userAgent)
+}
+
+// downloadFolder returns the folder argument at index, or the
+// download_folder setting
+func (f *configFlags) downloadFolder(args []string, index int) (string, bool) {
+	if len(args) > index {
+		return args[index], true
+	}
+	if v, ok := f.values["download_folder"]; ok {
+		return expandHome(v.Value), true
+	}
+	return "", false
+}
+
+// concurrency returns the number of files downloaded at the same time:
+// --concurrent (given as flag) or the optional concurrent_downloads argument
+// at index, then the concurrency setting, then 1 for sequential downloads
+func (f *configFlags) concurrency(flag int, args []string, index int) (int, error) {
+	value, source := "", "the command line"
+	v, fromConfig := f.values["concurrency"]
+	switch {
+	case f.given["concurrent"] && len(args) > index:
+		return 0, fmt.Errorf("give the number of concurrent downloads with --concurrent or as an argument, not both")
+	case f.given["concurrent"]:
+		value, source = strconv.Itoa(flag), "flag --concurrent"
+	case len(args) > index:
+		value = args[index]
+	case fromConfig:
+		value, source = v.Value, v.Source
+	default:
+		return 1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid concurrent_downloads %q from %s (use a whole number of at least 1)", value, source)
+	}
+	return n, nil
+}
+
+// expandHome replaces a leading ~ with the home folder
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// openHistory opens the download history. A history that can't be read is
+// not fatal: downloads go on without it.
+func openHistory() *history.DB {
+	db, err := history.Open(history.DefaultPath())
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return nil
+	}
+	return db
+}
+
+// withHistory records every finished download in the history
+func withHistory(opts downloader.Options, db *history.DB) downloader.Options {
+	if db == nil {
+		return opts
+	}
+	next := opts.OnComplete
+	opts.OnComplete = func(job downloader.Job, filePath string) {
+		if next != nil {
+			next(job, filePath)
+		}
+		entry := history.Entry{Series: job.Series, EpisodeID: job.EpisodeID, URL: job.URL, Page: job.Page, Path: filePath}
+		if err := db.Record(entry); err != nil {
+			fmt.Printf("\nWarning: %v\n", err)
+		}
+	}
+	return opts
+}
+
+// chooseVariants asks the user which variant to download for every HLS
+// master playlist and DASH manifest among the jobs. HLS jobs get the
+// variant's URL, DASH jobs a quality matching the chosen representation.
+func chooseVariants(ctx context.Context, jobs []downloader.Job) error {
+	for i, job := range jobs {
+		title := fmt.Sprintf("Choose a stream for %s", job.URL)
+		if job.EpisodeID != "" {
+			title = fmt.Sprintf("Choose a stream for %s", job.EpisodeID)
+		}
+
+		if dash.IsManifestURL(job.URL) {
+			manifest, err := dash.Load(ctx, nil, job.URL)
+			if err != nil {
+				return err
+			}
+			if len(manifest.Video) < 2 {
+				continue
+			}
+
+			var items []string
+			for _, rep := range manifest.Video {
+				items = append(items, rep.String())
+			}
+			choice, err := ui.SelectOne(ctx, title, items)
+			if err != nil {
+				return err
+			}
+			jobs[i].Quality = strconv.FormatInt(manifest.Video[choice].Bandwidth, 10)
+			continue
+		}
+
+		if !hls.IsPlaylistURL(job.URL) {
+			continue
+		}
+
+		playlist, err := hls.Load(ctx, nil, job.URL)
+		if err != nil {
+			return err
+		}
+		if !playlist.IsMaster() {
+			continue
+		}
+
+		var items []string
+		for _, v := range playlist.Variants {
+			items = append(items, v.String())
+		}
+
+		choice, err := ui.SelectOne(ctx, title, items)
+		if err != nil {
+			return err
+		}
+		jobs[i].URL = playlist.Variants[choice].URI
+	}
+	return nil
+}
+
+// signalContext returns a context cancelled by Ctrl+C or SIGTERM.
+// A second signal kills the process.
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// runDownloads downloads jobs into a folder, records them in the folder's
+// journal and exits with a non-zero status if anything did not finish
+func runDownloads(ctx context.Context, jobs []downloader.Job, downloadFolder string, opts downloader.Options) {
+	journal, err := downloader.OpenJournal(downloadFolder)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	opts.Journal = journal
+
+	watchRateSignals(opts.Limiter, opts.ConcurrentDownloads+1)
+	summary, err := downloader.Download(ctx, jobs, downloadFolder, opts)
+	if ctx.Err() != nil {
+		fmt.Println("Download cancelled")
+		summary.Print()
+		fmt.Printf("Continue later with: tt6d resume %s\n", downloadFolder)
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Printf("Error during download: %v\n", err)
+		os.Exit(1)
+	}
+	if len(summary.Failed) > 0 {
+		summary.Print()
+		os.Exit(1)
+	}
+}
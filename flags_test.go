@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"tt6d/pkg/config"
+)
+
+// TestConcurrencyPrecedence checks that config show reports the same
+// concurrency, from the same source, as a download uses
+func TestConcurrencyPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	file := "concurrency = 2\n\n[profile.nas]\nconcurrency = 4\n"
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TT6D_CONFIG", path)
+	t.Setenv("TT6D_PROFILE", "")
+
+	setting, ok := config.Lookup("concurrency")
+	if !ok {
+		t.Fatal("no concurrency setting")
+	}
+
+	tests := []struct {
+		name   string
+		env    string
+		args   []string
+		want   int
+		source string
+	}{
+		{"file", "", nil, 2, "config file"},
+		{"profile", "", []string{"--profile", "nas"}, 4, "profile nas"},
+		{"env", "5", []string{"--profile", "nas"}, 5, "env TT6D_CONCURRENCY"},
+		{"flag", "5", []string{"--profile", "nas", "--concurrent", "7"}, 7, "flag --concurrent"},
+		{"flag after the URL", "5", []string{"--concurrent=8"}, 8, "flag --concurrent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TT6D_CONCURRENCY", tt.env)
+
+			// As runDownload reads it
+			fs := flag.NewFlagSet("tt6d", flag.ContinueOnError)
+			var dl downloadFlags
+			dl.register(fs)
+			var cfg configFlags
+			cfg.register(fs)
+			args := parseArgs(fs, append([]string{"https://example.com/show", "/tmp/tv"}, tt.args...))
+			if err := cfg.apply(fs); err != nil {
+				t.Fatal(err)
+			}
+			got, err := cfg.concurrency(dl.concurrent, args, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("download uses %d, want %d", got, tt.want)
+			}
+
+			// As config show reports it
+			fs = flag.NewFlagSet("tt6d config show", flag.ContinueOnError)
+			dl = downloadFlags{}
+			dl.register(fs)
+			cfg = configFlags{}
+			cfg.register(fs)
+			parseArgs(fs, tt.args)
+			if err := cfg.apply(fs); err != nil {
+				t.Fatal(err)
+			}
+			value, source := settingSource(fs, &cfg, setting)
+			if value != strconv.Itoa(tt.want) || source != tt.source {
+				t.Errorf("config show reports %s from %s, want %d from %s", value, source, tt.want, tt.source)
+			}
+			if shown, err := cfg.concurrency(dl.concurrent, nil, 0); err != nil || shown != tt.want {
+				t.Errorf("config show checks %d (%v), want %d", shown, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyArgument(t *testing.T) {
+	t.Setenv("TT6D_CONFIG", filepath.Join(t.TempDir(), "missing.toml"))
+	t.Setenv("TT6D_PROFILE", "")
+	t.Setenv("TT6D_CONCURRENCY", "5")
+
+	tests := []struct {
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{[]string{"url", "dir", "3"}, 3, false},
+		{[]string{"url", "dir"}, 5, false},
+		{[]string{"url", "dir", "0"}, 0, true},
+		{[]string{"url", "dir", "3", "--concurrent", "2"}, 0, true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("tt6d", flag.ContinueOnError)
+		var dl downloadFlags
+		dl.register(fs)
+		var cfg configFlags
+		cfg.register(fs)
+		args := parseArgs(fs, tt.args)
+		if err := cfg.apply(fs); err != nil {
+			t.Fatal(err)
+		}
+		got, err := cfg.concurrency(dl.concurrent, args, 2)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q: got %d, %v; want %d (error %v)", tt.args, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLayoutTemplate(t *testing.T) {
+	tests := []struct {
+		layout   string
+		template string
+		wantErr  bool
+	}{
+		{"jellyfin", "", false},
+		{"jellyfin", "TV/{series}/S{season:02}/{id}.{ext}", false},
+		// The series folder would not hold the episodes
+		{"jellyfin", "Season {season:02}/{series}/{id}.{ext}", true},
+		{"plex", "{series} - {id}.{ext}", true},
+		{"flat", "Season {season:02}/{series}/{id}.{ext}", false},
+		{"flat", "", false},
+	}
+	for _, tt := range tests {
+		f := downloadFlags{layout: tt.layout, nameTemplate: tt.template, onExisting: "skip", quality: "best"}
+		_, mediaLayout, err := f.options(1)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("--layout %s --template %q: error %v, want error %v", tt.layout, tt.template, err, tt.wantErr)
+		}
+		if err == nil && mediaLayout != (tt.layout != "flat") {
+			t.Errorf("--layout %s: media layout %v", tt.layout, mediaLayout)
+		}
+	}
+}
@@ -1,34 +1,97 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
 
+	"tt6d/pkg/config"
 	"tt6d/pkg/downloader"
 	"tt6d/pkg/extractor"
+	"tt6d/pkg/history"
+	"tt6d/pkg/selection"
 	"tt6d/pkg/ui"
 )
 
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("TT6D - TodayTVSeries6 Downloader")
-		fmt.Println("Usage: tt6d <webpage_url> <download_folder> [concurrent_downloads]")
-		fmt.Println("Example:")
-		fmt.Println("  tt6d https://todaytvseries6.com/series/example /home/user/downloads")
-		fmt.Println("  tt6d https://todaytvseries6.com/series/example /home/user/downloads 3")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "resume":
+			runResume(os.Args[2:])
+			return
+		case "list":
+			runList(os.Args[2:])
+			return
+		case "extract":
+			runExtract(os.Args[2:])
+			return
+		case "rules":
+			runRules(os.Args[2:])
+			return
+		case "watch":
+			runWatch(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		}
+	}
+	runDownload(os.Args[1:])
+}
+
+// runDownload fetches a page, lets the user pick files and downloads them
+func runDownload(args []string) {
+	fs := flag.NewFlagSet("tt6d", flag.ExitOnError)
+	var dl downloadFlags
+	dl.register(fs)
+	var sel selectFlags
+	sel.register(fs)
+	var cfg configFlags
+	cfg.register(fs)
+	rulesPath := fs.String("rules", "", "extraction rules file for other sites (default: "+extractor.DefaultRulesPath()+" if present)")
+	fs.Usage = usage(fs)
+
+	args = parseArgs(fs, args)
+	if len(args) < 1 || len(args) > 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := cfg.apply(fs); err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	pageURL := os.Args[1]
-	downloadFolder := os.Args[2]
+	pageURL := args[0]
+	downloadFolder, ok := cfg.downloadFolder(args, 1)
+	if !ok {
+		fmt.Println("Error: no download folder given and no download_folder in " + config.DefaultPath())
+		os.Exit(1)
+	}
 
-	// Set concurrent downloads (default: 1 for sequential downloads)
-	concurrentDownloads := 1
-	if len(os.Args) > 3 {
-		if n, err := strconv.Atoi(os.Args[3]); err == nil && n > 0 {
-			concurrentDownloads = n
+	concurrentDownloads, err := cfg.concurrency(dl.concurrent, args, 2)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts, mediaLayout, err := dl.options(concurrentDownloads)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tmpl := opts.Template
+	criteria, err := sel.criteria()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		var syntaxErr *selection.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			fmt.Println(syntaxErr.Pointer())
 		}
+		os.Exit(1)
 	}
 
 	// Create download folder if it doesn't exist
@@ -37,26 +100,84 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := loadRules(*rulesPath); err != nil {
+		fmt.Printf("Error loading rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := signalContext()
+	loadPlugins(ctx)
+	db := openHistory()
+	opts = withHistory(opts, db)
+
 	fmt.Printf("Fetching page: %s\n", pageURL)
-	links, seriesInfo, err := extractor.ExtractContent(pageURL)
+	links, seriesInfo, err := extractor.ExtractContent(ctx, pageURL)
+	if ctx.Err() != nil {
+		fmt.Println("Cancelled")
+		os.Exit(130)
+	}
 	if err != nil {
 		fmt.Printf("Error extracting content: %v\n", err)
 		os.Exit(1)
 	}
 
-	var selectedLinks []string
+	var jobs []downloader.Job
 	if seriesInfo != nil {
 		fmt.Printf("Found TV Series: %s\n", seriesInfo.Title)
-		selectedLinks, err = ui.SelectTVSeriesEpisodes(seriesInfo)
+		// Mark episodes that are already in the download folder or were
+		// downloaded before and moved elsewhere
+		downloaded := func(ep extractor.Episode) bool {
+			if _, ok := db.Episode(seriesInfo.Title, ep.ID); ok {
+				return true
+			}
+			return downloader.Exists(episodeJob(pageURL, seriesInfo, ep), downloadFolder, tmpl)
+		}
+
+		var episodes []extractor.Episode
+		if criteria.IsSet() {
+			episodes, err = selection.Episodes(seriesInfo, criteria)
+			if err == nil && !sel.redownload {
+				episodes = skipDownloadedEpisodes(db, seriesInfo, episodes)
+			}
+		} else {
+			episodes, err = ui.SelectTVSeriesEpisodes(ctx, seriesInfo, downloaded)
+		}
+		for _, ep := range episodes {
+			if len(ep.Links) > 0 {
+				jobs = append(jobs, episodeJob(pageURL, seriesInfo, ep))
+			}
+		}
 	} else {
 		if len(links) == 0 {
-			fmt.Println("No MP4 links found on the page")
+			fmt.Println("No MP4, HLS or DASH links found on the page")
 			return
 		}
-		fmt.Printf("Found %d MP4 links\n", len(links))
-		selectedLinks, err = ui.GetSelectedLinks(links)
+		fmt.Printf("Found %d video links\n", len(links))
+		downloaded := func(link string) bool {
+			if _, ok := db.Link(link); ok {
+				return true
+			}
+			return downloader.Exists(downloader.Job{URL: link}, downloadFolder, tmpl)
+		}
+
+		var selectedLinks []string
+		if criteria.IsSet() {
+			selectedLinks, err = selection.Links(links, criteria)
+			if err == nil && !sel.redownload {
+				selectedLinks = skipDownloadedLinks(db, selectedLinks)
+			}
+		} else {
+			selectedLinks, err = ui.GetSelectedLinks(ctx, links, downloaded)
+		}
+		for _, link := range selectedLinks {
+			jobs = append(jobs, downloader.Job{URL: link, Page: pageURL})
+		}
 	}
 
+	if ctx.Err() != nil {
+		fmt.Println("\nCancelled")
+		os.Exit(130)
+	}
 	if err != nil {
 		if err.Error() == "no files selected" || err.Error() == "no episodes selected" {
 			fmt.Println("\nNo files selected for download")
@@ -66,10 +187,121 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(jobs) == 0 {
+		fmt.Println("Nothing new to download")
+		return
+	}
+
+	if opts.Quality == "ask" {
+		if err := chooseVariants(ctx, jobs); err != nil {
+			if ctx.Err() != nil {
+				fmt.Println("\nCancelled")
+				os.Exit(130)
+			}
+			fmt.Printf("Error choosing stream: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if mediaLayout && seriesInfo != nil {
+		if err := writeSeriesMetadata(ctx, seriesInfo, downloadFolder, opts.Template); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
 	// Download selected files using the downloader package
-	if err := downloader.Download(selectedLinks, downloadFolder, concurrentDownloads); err != nil {
-		fmt.Printf("Error during download: %v\n", err)
-		os.Exit(1)
+	runDownloads(ctx, jobs, downloadFolder, opts)
+}
+
+// episodeJob turns an episode found on pageURL into a download job. The
+// first link is tried first and the others are used as mirrors.
+func episodeJob(pageURL string, info *extractor.TVSeriesInfo, ep extractor.Episode) downloader.Job {
+	job := downloader.Job{
+		Page:       pageURL,
+		Series:     info.Title,
+		EpisodeID:  ep.ID,
+		Season:     ep.Season,
+		Episode:    ep.Episode,
+		Title:      ep.Title,
+		QualityTag: ep.Quality,
+		Size:       ep.Size,
 	}
+	if len(ep.Links) > 0 {
+		job.URL = ep.Links[0]
+		job.Mirrors = ep.Links[1:]
+	}
+	return job
+}
 
+// skipDownloadedEpisodes leaves out the episodes the download history has
+func skipDownloadedEpisodes(db *history.DB, info *extractor.TVSeriesInfo, episodes []extractor.Episode) []extractor.Episode {
+	var remaining []extractor.Episode
+	for _, ep := range episodes {
+		if entry, ok := db.Episode(info.Title, ep.ID); ok {
+			fmt.Printf("Skipping %s: downloaded on %s to %s\n", ep.ID, entry.Time.Format("2006-01-02"), entry.Path)
+			continue
+		}
+		remaining = append(remaining, ep)
+	}
+	return remaining
+}
+
+// skipDownloadedLinks leaves out the links the download history has
+func skipDownloadedLinks(db *history.DB, links []string) []string {
+	var remaining []string
+	for _, link := range links {
+		if entry, ok := db.Link(link); ok {
+			fmt.Printf("Skipping %s: downloaded on %s to %s\n", link, entry.Time.Format("2006-01-02"), entry.Path)
+			continue
+		}
+		remaining = append(remaining, link)
+	}
+	return remaining
+}
+
+// loadPlugins registers the provider plugins found in the plugin folder and
+// on PATH, warning about the ones that don't work
+func loadPlugins(ctx context.Context) {
+	for _, err := range extractor.RegisterPlugins(ctx, extractor.DefaultPluginDir()) {
+		fmt.Printf("Warning: skipping plugin %v\n", err)
+	}
+}
+
+// usage prints the help text followed by the flag defaults
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println("TT6D - TodayTVSeries6 Downloader")
+		fmt.Println("Usage: tt6d [options] <webpage_url> [download_folder] [concurrent_downloads]")
+		fmt.Println("       tt6d resume [options] [download_folder] [concurrent_downloads]")
+		fmt.Println("       tt6d list [--format table|tree|json] <webpage_url>")
+		fmt.Println("       tt6d extract --html <file|-> [--base-url URL] [--format tree|json]")
+		fmt.Println("       tt6d rules test [options] <rules_file> <saved_page.html>")
+		fmt.Println("       tt6d watch add|remove|list|run [options]")
+		fmt.Println("       tt6d history [--series NAME] [--episode S01E02] [--since 48h] [--json]")
+		fmt.Println("       tt6d config show [--profile NAME]")
+		fmt.Println("Example:")
+		fmt.Println("  tt6d https://todaytvseries6.com/series/example /home/user/downloads")
+		fmt.Println("  tt6d https://todaytvseries6.com/series/example /home/user/downloads 3")
+		fmt.Println("  tt6d --connections 4 https://todaytvseries6.com/series/example /home/user/downloads")
+		fmt.Println("  tt6d --season 2 --latest https://todaytvseries6.com/series/example /home/user/downloads")
+		fmt.Println("  tt6d --profile nas https://todaytvseries6.com/series/example")
+		fmt.Println("Defaults are read from " + config.DefaultPath() + ".")
+		fmt.Println("Options:")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+	}
+}
+
+// parseArgs parses flags that may appear before, between or after positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"tt6d/pkg/downloader"
+	"tt6d/pkg/extractor"
+	"tt6d/pkg/nfo"
+)
+
+// mediaServerTemplate is the folder layout Jellyfin, Kodi and Plex expect
+const mediaServerTemplate = "{series}/Season {season:02}/{series} - S{season:02}E{episode:02}.{ext}"
+
+// writeSeriesMetadata creates the series folder with a tvshow.nfo and the
+// poster. The folder is named by tmpl exactly as the episode paths are.
+func writeSeriesMetadata(ctx context.Context, info *extractor.TVSeriesInfo, downloadFolder string, tmpl *downloader.Template) error {
+	folder, ok := tmpl.SeriesFolder(info.Title)
+	if !ok {
+		return fmt.Errorf("the naming template has no series folder for the metadata")
+	}
+	seriesDir := filepath.Join(downloadFolder, folder)
+	if err := os.MkdirAll(seriesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create series folder: %v", err)
+	}
+
+	show := nfo.TVShow{Title: info.Title}
+	if info.Poster != "" {
+		poster, err := downloadPoster(ctx, info.Poster, seriesDir)
+		if err != nil {
+			fmt.Printf("Warning: could not download poster: %v\n", err)
+		} else {
+			show.Thumb = poster
+		}
+	}
+
+	return nfo.WriteFile(filepath.Join(seriesDir, "tvshow.nfo"), show)
+}
+
+// writeEpisodeNFO writes the .nfo file that sits next to an episode
+func writeEpisodeNFO(job downloader.Job, filePath string) error {
+	if job.EpisodeID == "" {
+		return nil
+	}
+
+	title := job.Title
+	if title == "" {
+		title = job.EpisodeID
+	}
+	nfoPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".nfo"
+	return nfo.WriteFile(nfoPath, nfo.Episode{
+		Title:     title,
+		ShowTitle: job.Series,
+		Season:    job.Season,
+		Episode:   job.Episode,
+	})
+}
+
+// downloadPoster saves the poster image as poster.<ext> and returns its filename
+func downloadPoster(ctx context.Context, posterURL, seriesDir string) (string, error) {
+	ext := ".jpg"
+	if parsed, err := url.Parse(posterURL); err == nil {
+		switch e := strings.ToLower(path.Ext(parsed.Path)); e {
+		case ".png", ".webp", ".jpeg":
+			ext = e
+		}
+	}
+	filename := "poster" + ext
+	posterPath := filepath.Join(seriesDir, filename)
+
+	if _, err := os.Stat(posterPath); err == nil {
+		return filename, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, posterURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch poster: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("poster returned status code: %d", resp.StatusCode)
+	}
+
+	out, err := os.Create(posterPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create poster file: %v", err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(posterPath)
+		return "", fmt.Errorf("failed to save poster: %v", err)
+	}
+	return filename, out.Close()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// configureHTTP sets the proxy and User-Agent of http.DefaultClient, which
+// every page, playlist and file request goes through. Without a proxy the
+// usual HTTP_PROXY and HTTPS_PROXY variables apply.
+func configureHTTP(proxy, userAgent string) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return fmt.Errorf("invalid proxy %q (use a URL such as http://host:8080 or socks5://host:1080)", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var rt http.RoundTripper = transport
+	if userAgent != "" {
+		rt = userAgentTransport{next: transport, userAgent: userAgent}
+	}
+	http.DefaultClient.Transport = rt
+	return nil
+}
+
+// userAgentTransport adds a User-Agent header to requests that have none
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"tt6d/pkg/extractor"
+)
+
+// documentVersion is increased whenever pageDocument changes in a way that
+// breaks existing readers. New fields may be added without a new version.
+const documentVersion = 1
+
+// pageDocument is the JSON form of what was found on a page. Series and
+// plain link pages share the layout, told apart by Kind.
+type pageDocument struct {
+	Version int              `json:"version"`
+	Kind    string           `json:"kind"` // "series" or "links"
+	URL     string           `json:"url"`
+	Title   string           `json:"title"`
+	Poster  string           `json:"poster"`
+	Seasons []seasonDocument `json:"seasons"`
+	Links   []string         `json:"links"`
+}
+
+// seasonDocument is one season of a pageDocument
+type seasonDocument struct {
+	Season   string              `json:"season"`
+	Label    string              `json:"label"`
+	Episodes []extractor.Episode `json:"episodes"`
+}
+
+// newPageDocument collects the result of an extraction, with seasons in
+// natural order and episodes in page order
+func newPageDocument(pageURL string, links []string, info *extractor.TVSeriesInfo) pageDocument {
+	doc := pageDocument{
+		Version: documentVersion,
+		Kind:    "links",
+		URL:     pageURL,
+		Seasons: []seasonDocument{},
+		Links:   append([]string{}, links...),
+	}
+	if info == nil {
+		return doc
+	}
+	doc.Kind = "series"
+	doc.Title = info.Title
+	doc.Poster = info.Poster
+	for _, season := range info.SeasonNames() {
+		episodes := append([]extractor.Episode{}, info.Seasons[season]...)
+		for i := range episodes {
+			// Episodes without links still get a list in JSON
+			if episodes[i].Links == nil {
+				episodes[i].Links = []string{}
+			}
+		}
+		doc.Seasons = append(doc.Seasons, seasonDocument{
+			Season:   season,
+			Label:    extractor.SeasonLabel(season),
+			Episodes: episodes,
+		})
+	}
+	return doc
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// printTable writes a page document as aligned columns, one row per
+// episode or link
+func printTable(w io.Writer, doc pageDocument) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if doc.Kind != "series" {
+		fmt.Fprintln(tw, "#\tURL")
+		for i, link := range doc.Links {
+			fmt.Fprintf(tw, "%d\t%s\n", i+1, link)
+		}
+		return tw.Flush()
+	}
+
+	fmt.Fprintln(tw, "SEASON\tEPISODE\tTITLE\tSIZE\tQUALITY\tMIRRORS\tURL")
+	for _, season := range doc.Seasons {
+		for _, ep := range season.Episodes {
+			size, link := "-", "-"
+			if ep.Size > 0 {
+				size = extractor.FormatSize(ep.Size)
+			}
+			if len(ep.Links) > 0 {
+				link = ep.Links[0]
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				season.Label, ep.ID, orDash(ep.Title), size, orDash(ep.Quality), len(ep.Links), link)
+		}
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printTree writes a page document as an indented tree
+func printTree(w io.Writer, doc pageDocument) {
+	if len(doc.Seasons) == 0 {
+		fmt.Fprintf(w, "%d links\n", len(doc.Links))
+		for i, link := range doc.Links {
+			fmt.Fprintf(w, "%s%s\n", branch(i, len(doc.Links)), link)
+		}
+		return
+	}
+
+	fmt.Fprintln(w, doc.Title)
+	if doc.Poster != "" {
+		fmt.Fprintf(w, "│   Poster: %s\n", doc.Poster)
+	}
+	for i, season := range doc.Seasons {
+		lastSeason := i == len(doc.Seasons)-1
+		fmt.Fprintf(w, "%s%s (%d episodes)\n", branch(i, len(doc.Seasons)), season.Label, len(season.Episodes))
+		indent := indentFor(lastSeason)
+		for j, ep := range season.Episodes {
+			line := ep.ID
+			if details := episodeSummary(ep); details != "" {
+				line += "  " + details
+			}
+			fmt.Fprintf(w, "%s%s%s\n", indent, branch(j, len(season.Episodes)), line)
+			linkIndent := indent + indentFor(j == len(season.Episodes)-1)
+			for k, link := range ep.Links {
+				fmt.Fprintf(w, "%s%s%s\n", linkIndent, branch(k, len(ep.Links)), link)
+			}
+		}
+	}
+}
+
+// episodeSummary lists an episode's title, size and quality
+func episodeSummary(ep extractor.Episode) string {
+	var details []string
+	if ep.Title != "" {
+		details = append(details, ep.Title)
+	}
+	if ep.Size > 0 {
+		details = append(details, extractor.FormatSize(ep.Size))
+	}
+	if ep.Quality != "" {
+		details = append(details, ep.Quality)
+	}
+	return strings.Join(details, " • ")
+}
+
+// branch returns the tree connector for item i of n
+func branch(i, n int) string {
+	if i == n-1 {
+		return "└── "
+	}
+	return "├── "
+}
+
+// indentFor returns the indentation below an item, continuing the tree
+// line unless the item was the last one
+func indentFor(last bool) string {
+	if last {
+		return "    "
+	}
+	return "│   "
+}
@@ -0,0 +1,181 @@
+// Package config reads the tt6d configuration file and works out where each
+// setting comes from. Command line flags win over environment variables,
+// which win over the selected profile, which wins over the top of the file.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Setting is one option that can be set in the file or the environment
+type Setting struct {
+	// Key is the name in config.toml, e.g. "limit_rate"
+	Key string
+	// Flag is the command line flag for the setting, or "" if it is given
+	// as an argument instead
+	Flag string
+	Help string
+}
+
+// Env returns the environment variable for the setting, e.g. TT6D_LIMIT_RATE
+func (s Setting) Env() string {
+	return "TT6D_" + strings.ToUpper(s.Key)
+}
+
+// Settings are all the options the file may contain
+var Settings = []Setting{
+	{Key: "download_folder", Help: "folder to download into when none is given"},
+	{Key: "concurrency", Flag: "concurrent", Help: "files downloaded at the same time when not given"},
+	{Key: "limit_rate", Flag: "limit-rate", Help: "total bandwidth limit, e.g. 2M"},
+	{Key: "template", Flag: "template", Help: "output path template for episodes"},
+	{Key: "retries", Flag: "retries", Help: "maximum download attempts per file"},
+	{Key: "retry_delay", Flag: "retry-delay", Help: "initial delay between attempts, e.g. \"2s\""},
+	{Key: "retry_max_delay", Flag: "retry-max-delay", Help: "maximum delay between attempts"},
+	{Key: "proxy", Flag: "proxy", Help: "HTTP or SOCKS5 proxy URL"},
+	{Key: "user_agent", Flag: "user-agent", Help: "User-Agent header sent with every request"},
+	{Key: "theme", Flag: "theme", Help: "selector colours: default, light or mono"},
+}
+
+// Value is the effective value of a setting and where it came from
+type Value struct {
+	Value  string
+	Source string // e.g. "env TT6D_PROXY", "profile nas" or "config file"
+}
+
+// File is a parsed config.toml. Settings at the top are defaults; tables
+// such as [profile.nas] override them when the profile is selected.
+type File struct {
+	Path     string
+	Values   map[string]string
+	Profiles map[string]map[string]string
+}
+
+// DefaultPath returns $TT6D_CONFIG, or config.toml in the tt6d config
+// folder (~/.config/tt6d on Linux)
+func DefaultPath() string {
+	if path := os.Getenv("TT6D_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tt6d", "config.toml")
+}
+
+// Load reads a config file. A missing file is the same as an empty one.
+func Load(path string) (*File, error) {
+	f := &File{Path: path, Values: map[string]string{}, Profiles: map[string]map[string]string{}}
+	if path == "" {
+		return f, nil
+	}
+
+	var raw map[string]interface{}
+	if _, err := toml.DecodeFile(path, &raw); err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	for key, value := range raw {
+		if key != "profile" {
+			s, err := settingValue(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			f.Values[key] = s
+			continue
+		}
+
+		profiles, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: profiles must be tables such as [profile.nas]", path)
+		}
+		for name, table := range profiles {
+			settings, ok := table.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: profile %q must be a table such as [profile.%s]", path, name, name)
+			}
+			f.Profiles[name] = map[string]string{}
+			for key, value := range settings {
+				s, err := settingValue(key, value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: profile %q: %v", path, name, err)
+				}
+				f.Profiles[name][key] = s
+			}
+		}
+	}
+	return f, nil
+}
+
+// settingValue checks that a key is a known setting and turns its value
+// into the form a command line flag would take
+func settingValue(key string, value interface{}) (string, error) {
+	if _, ok := Lookup(key); !ok {
+		return "", fmt.Errorf("unknown setting %q", key)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int64, float64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("%s must be a string or a number", key)
+}
+
+// Lookup returns the setting with a key
+func Lookup(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// ProfileNames returns the profiles in the file, sorted
+func (f *File) ProfileNames() []string {
+	var names []string
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the settings given by the environment, a profile ("" for
+// none) and the file, keeping the first source of each in that order.
+// Settings that none of them give are left out.
+func (f *File) Resolve(profile string) (map[string]Value, error) {
+	var overrides map[string]string
+	if profile != "" {
+		var ok bool
+		if overrides, ok = f.Profiles[profile]; !ok {
+			available := "none"
+			if names := f.ProfileNames(); len(names) > 0 {
+				available = strings.Join(names, ", ")
+			}
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, available)
+		}
+	}
+
+	values := make(map[string]Value)
+	for _, s := range Settings {
+		if v := os.Getenv(s.Env()); v != "" {
+			values[s.Key] = Value{Value: v, Source: "env " + s.Env()}
+		} else if v, ok := overrides[s.Key]; ok {
+			values[s.Key] = Value{Value: v, Source: "profile " + profile}
+		} else if v, ok := f.Values[s.Key]; ok {
+			values[s.Key] = Value{Value: v, Source: "config file"}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,226 @@
+package dash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"tt6d/pkg/hls"
+)
+
+// Fetcher opens a URL for reading
+type Fetcher func(ctx context.Context, url string) (io.ReadCloser, error)
+
+// IsManifestURL reports whether a link looks like a DASH manifest
+func IsManifestURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".mpd")
+}
+
+// Load fetches and parses a manifest
+func Load(ctx context.Context, fetch Fetcher, manifestURL string) (*Manifest, error) {
+	if fetch == nil {
+		fetch = hls.DefaultFetcher
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest URL: %v", err)
+	}
+
+	body, err := fetch(ctx, manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer body.Close()
+
+	return Parse(body, base)
+}
+
+// Select picks the video representation matching quality (same values as
+// hls.SelectVariant) and the best audio representation in the first
+// language listed, and returns them as a stream
+func Select(m *Manifest, quality string) (*Stream, error) {
+	var tracks []Representation
+
+	if len(m.Video) > 0 {
+		video, err := selectRepresentation(m.Video, quality)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, video)
+	}
+
+	if len(m.Audio) > 0 {
+		var audio []Representation
+		for _, rep := range m.Audio {
+			if rep.Lang == m.Audio[0].Lang {
+				audio = append(audio, rep)
+			}
+		}
+		audioQuality := "best"
+		if strings.EqualFold(strings.TrimSpace(quality), "worst") {
+			audioQuality = "worst"
+		}
+		rep, err := selectRepresentation(audio, audioQuality)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, rep)
+	}
+
+	return NewStream(tracks...), nil
+}
+
+// selectRepresentation applies the HLS variant rules to representations
+func selectRepresentation(reps []Representation, quality string) (Representation, error) {
+	variants := make([]hls.Variant, len(reps))
+	for i, rep := range reps {
+		variants[i] = hls.Variant{URI: fmt.Sprint(i), Bandwidth: rep.Bandwidth, Width: rep.Width, Height: rep.Height}
+	}
+	chosen, err := hls.SelectVariant(variants, quality)
+	if err != nil {
+		return Representation{}, err
+	}
+	for i, v := range variants {
+		if v.URI == chosen.URI {
+			return reps[i], nil
+		}
+	}
+	return Representation{}, fmt.Errorf("no representation matches %q", quality)
+}
+
+// Stream is a set of tracks muxed into one fragmented MP4. Segments of all
+// tracks are interleaved by presentation time.
+type Stream struct {
+	Tracks []Representation
+	pieces []piece
+}
+
+// piece is one media segment of one track, in output order
+type piece struct {
+	track int
+	uri   string
+}
+
+// NewStream orders the segments of the given tracks for writing
+func NewStream(tracks ...Representation) *Stream {
+	type timed struct {
+		piece
+		start float64
+	}
+	var all []timed
+	for i, track := range tracks {
+		for _, seg := range track.Segments {
+			all = append(all, timed{piece: piece{track: i, uri: seg.URI}, start: seg.Start})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].track < all[j].track
+	})
+
+	s := &Stream{Tracks: tracks}
+	for _, t := range all {
+		s.pieces = append(s.pieces, t.piece)
+	}
+	return s
+}
+
+// Len returns the number of media segments in the stream
+func (s *Stream) Len() int {
+	return len(s.pieces)
+}
+
+// ID identifies the chosen tracks, so a partial file is only continued
+// with the same selection
+func (s *Stream) ID() string {
+	var ids []string
+	for _, track := range s.Tracks {
+		ids = append(ids, track.ID)
+	}
+	return strings.Join(ids, "+")
+}
+
+// Options controls how segments are downloaded
+type Options struct {
+	// Concurrency is the number of segments fetched at the same time
+	Concurrency int
+	// Fetch opens segment URLs (defaults to hls.DefaultFetcher)
+	Fetch Fetcher
+	// Start is the index of the first segment to fetch, for resuming. The
+	// file header is only written when Start is 0.
+	Start int
+	// OnSegment is called after segment index has been written, with the
+	// number of bytes it added
+	OnSegment func(index int, written int64)
+}
+
+// Download fetches the segments of the stream concurrently and writes a
+// single fragmented MP4 with all tracks to w
+func (s *Stream) Download(ctx context.Context, w io.Writer, opts Options) error {
+	if len(s.Tracks) == 0 {
+		return fmt.Errorf("no tracks to download")
+	}
+	if opts.Fetch == nil {
+		opts.Fetch = hls.DefaultFetcher
+	}
+
+	if opts.Start == 0 {
+		var inits [][]byte
+		for i, track := range s.Tracks {
+			if track.Init == "" {
+				return fmt.Errorf("track %s has no initialization segment", track.ID)
+			}
+			data, err := fetchAll(ctx, opts.Fetch, track.Init)
+			if err != nil {
+				return fmt.Errorf("track %d init segment: %w", i+1, err)
+			}
+			inits = append(inits, data)
+		}
+		header, err := mergeInits(inits)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(header); err != nil {
+			return fmt.Errorf("failed to write header: %v", err)
+		}
+	}
+
+	fetch := func(ctx context.Context, i int) ([]byte, error) {
+		return fetchAll(ctx, opts.Fetch, s.pieces[i].uri)
+	}
+	return hls.FetchSegments(ctx, opts.Start, len(s.pieces), opts.Concurrency, fetch, func(i int, data []byte) error {
+		// Fragment sequence numbers must increase through the file; deriving
+		// them from the segment index keeps them stable across resumes
+		data, err := rewriteFragments(data, uint32(s.pieces[i].track+1), uint32(i+1)<<8)
+		if err != nil {
+			return fmt.Errorf("segment %d: %v", i+1, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write segment %d: %v", i+1, err)
+		}
+		if opts.OnSegment != nil {
+			opts.OnSegment(i, int64(len(data)))
+		}
+		return nil
+	})
+}
+
+// fetchAll downloads a whole URL into memory
+func fetchAll(ctx context.Context, fetch Fetcher, uri string) ([]byte, error) {
+	body, err := fetch(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
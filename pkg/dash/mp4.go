@@ -0,0 +1,239 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// box is an ISO BMFF box; data holds the whole box including its header
+type box struct {
+	typ    string
+	data   []byte
+	header int
+}
+
+// payload returns the box contents after the header
+func (b box) payload() []byte {
+	return b.data[b.header:]
+}
+
+// readBoxes splits data into consecutive boxes
+func readBoxes(data []byte) ([]box, error) {
+	var boxes []box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := 8
+		switch size {
+		case 0:
+			// The box runs to the end of the data
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("truncated %s box header", typ)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < uint64(header) || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid size for %s box", typ)
+		}
+		boxes = append(boxes, box{typ: typ, data: data[:size], header: header})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// makeBox builds a box from a type and its children or payload
+func makeBox(typ string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	out := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(out, uint32(size))
+	copy(out[4:], typ)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// findBox returns the first box of the given type
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// setTrackID overwrites the track_ID of a tkhd, trex or tfhd box in place
+func setTrackID(b box, id uint32) error {
+	p := b.payload()
+	offset := 4 // version and flags
+	if b.typ == "tkhd" {
+		// creation and modification times come first, 32 or 64 bits each
+		offset += 8
+		if len(p) > 0 && p[0] == 1 {
+			offset += 8
+		}
+	}
+	if len(p) < offset+4 {
+		return fmt.Errorf("truncated %s box", b.typ)
+	}
+	binary.BigEndian.PutUint32(p[offset:], id)
+	return nil
+}
+
+// mergeInits combines the initialization segments of several fragmented
+// MP4 tracks into one ftyp and moov, numbering the tracks from 1
+func mergeInits(inits [][]byte) ([]byte, error) {
+	var ftyp, mvhd []byte
+	var traks, trexs, extra [][]byte
+
+	for i, init := range inits {
+		id := uint32(i + 1)
+		if bytes.Contains(init, []byte("encv")) || bytes.Contains(init, []byte("enca")) {
+			return nil, fmt.Errorf("track %d is encrypted (DRM), which is not supported", id)
+		}
+
+		boxes, err := readBoxes(init)
+		if err != nil {
+			return nil, fmt.Errorf("track %d init segment: %v", id, err)
+		}
+		if ftyp == nil {
+			if b, ok := findBox(boxes, "ftyp"); ok {
+				ftyp = b.data
+			}
+		}
+		moov, ok := findBox(boxes, "moov")
+		if !ok {
+			return nil, fmt.Errorf("track %d init segment has no moov box", id)
+		}
+		children, err := readBoxes(moov.payload())
+		if err != nil {
+			return nil, fmt.Errorf("track %d moov: %v", id, err)
+		}
+
+		for _, child := range children {
+			switch child.typ {
+			case "mvhd":
+				if mvhd == nil {
+					mvhd = append([]byte(nil), child.data...)
+				}
+			case "trak":
+				trak := append([]byte(nil), child.data...)
+				parts, err := readBoxes(trak[child.header:])
+				if err != nil {
+					return nil, fmt.Errorf("track %d trak: %v", id, err)
+				}
+				tkhd, ok := findBox(parts, "tkhd")
+				if !ok {
+					return nil, fmt.Errorf("track %d has no tkhd box", id)
+				}
+				if err := setTrackID(tkhd, id); err != nil {
+					return nil, err
+				}
+				traks = append(traks, trak)
+			case "mvex":
+				parts, err := readBoxes(child.payload())
+				if err != nil {
+					return nil, fmt.Errorf("track %d mvex: %v", id, err)
+				}
+				trex, ok := findBox(parts, "trex")
+				if !ok {
+					return nil, fmt.Errorf("track %d has no trex box", id)
+				}
+				trex.data = append([]byte(nil), trex.data...)
+				if err := setTrackID(trex, id); err != nil {
+					return nil, err
+				}
+				trexs = append(trexs, trex.data)
+			default:
+				// Keep udta and similar boxes from the first track only
+				if i == 0 {
+					extra = append(extra, child.data)
+				}
+			}
+		}
+	}
+
+	if mvhd == nil {
+		return nil, fmt.Errorf("init segment has no mvhd box")
+	}
+	if len(trexs) != len(inits) {
+		return nil, fmt.Errorf("init segment is not a fragmented MP4")
+	}
+	// next_track_ID is the last field of mvhd
+	binary.BigEndian.PutUint32(mvhd[len(mvhd)-4:], uint32(len(inits)+1))
+
+	moov := [][]byte{mvhd}
+	moov = append(moov, traks...)
+	moov = append(moov, makeBox("mvex", trexs...))
+	moov = append(moov, extra...)
+
+	out := append([]byte(nil), ftyp...)
+	return append(out, makeBox("moov", moov...)...), nil
+}
+
+// rewriteFragments returns the moof and mdat boxes of a media segment with
+// the track renumbered to id. Fragment sequence numbers start at sequence.
+// Index boxes (styp, sidx, ...) are dropped since their offsets would no
+// longer be valid in the combined file.
+func rewriteFragments(data []byte, id uint32, sequence uint32) ([]byte, error) {
+	boxes, err := readBoxes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for _, b := range boxes {
+		switch b.typ {
+		case "moof":
+			children, err := readBoxes(b.payload())
+			if err != nil {
+				return nil, fmt.Errorf("moof: %v", err)
+			}
+			for _, child := range children {
+				switch child.typ {
+				case "mfhd":
+					p := child.payload()
+					if len(p) < 8 {
+						return nil, fmt.Errorf("truncated mfhd box")
+					}
+					binary.BigEndian.PutUint32(p[4:], sequence)
+					sequence++
+				case "traf":
+					parts, err := readBoxes(child.payload())
+					if err != nil {
+						return nil, fmt.Errorf("traf: %v", err)
+					}
+					tfhd, ok := findBox(parts, "tfhd")
+					if !ok {
+						return nil, fmt.Errorf("traf has no tfhd box")
+					}
+					// An absolute base offset would point into the original file
+					if p := tfhd.payload(); len(p) >= 4 && p[3]&0x01 != 0 {
+						return nil, fmt.Errorf("fragments with an explicit base data offset are not supported")
+					}
+					if err := setTrackID(tfhd, id); err != nil {
+						return nil, err
+					}
+				}
+			}
+			out = append(out, b.data...)
+		case "mdat":
+			out = append(out, b.data...)
+		}
+	}
+	if out == nil {
+		return nil, fmt.Errorf("segment has no movie fragments")
+	}
+	return out, nil
+}
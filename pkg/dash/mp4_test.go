@@ -0,0 +1,303 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// fullBox builds a box with a version and flags before its fields
+func fullBox(typ string, version byte, flags uint32, fields ...[]byte) []byte {
+	header := u32(flags)
+	header[0] = version
+	return makeBox(typ, append([][]byte{header}, fields...)...)
+}
+
+// mvhdBox is a version 0 mvhd with next_track_ID as its last field
+func mvhdBox(nextTrackID uint32) []byte {
+	return fullBox("mvhd", 0, 0, make([]byte, 92), u32(nextTrackID))
+}
+
+// tkhdBox is a tkhd of the given version, whose times are 32 or 64 bits
+func tkhdBox(version byte, trackID uint32) []byte {
+	times := make([]byte, 8)
+	if version == 1 {
+		times = make([]byte, 16)
+	}
+	return fullBox("tkhd", version, 3, times, u32(trackID), make([]byte, 60))
+}
+
+func trexBox(trackID uint32) []byte {
+	return fullBox("trex", 0, 0, u32(trackID), make([]byte, 16))
+}
+
+// initSegment is the init segment of a single track fragmented MP4
+func initSegment(tkhdVersion byte, trackID uint32, sampleEntry string, extra ...[]byte) []byte {
+	trak := makeBox("trak", tkhdBox(tkhdVersion, trackID), makeBox("mdia", makeBox("stsd", []byte(sampleEntry))))
+	moov := [][]byte{mvhdBox(trackID + 1), trak, makeBox("mvex", trexBox(trackID))}
+	moov = append(moov, extra...)
+	return append(makeBox("ftyp", []byte("iso6"), u32(0), []byte("iso6dash")), makeBox("moov", moov...)...)
+}
+
+// trackID reads the track_ID of a tkhd, trex or tfhd box
+func trackID(t *testing.T, b box) uint32 {
+	t.Helper()
+	offset := 4
+	if b.typ == "tkhd" {
+		offset += 8
+		if b.payload()[0] == 1 {
+			offset += 8
+		}
+	}
+	return binary.BigEndian.Uint32(b.payload()[offset:])
+}
+
+// mustBoxes splits data into boxes and checks the sizes add up
+func mustBoxes(t *testing.T, data []byte) []box {
+	t.Helper()
+	boxes, err := readBoxes(data)
+	if err != nil {
+		t.Fatalf("readBoxes: %v", err)
+	}
+	return boxes
+}
+
+func boxTypes(boxes []box) string {
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	return strings.Join(types, " ")
+}
+
+func TestReadBoxes(t *testing.T) {
+	large := append(u32(1), []byte("mdat")...)
+	large = append(large, 0, 0, 0, 0, 0, 0, 0, 20)
+	large = append(large, 1, 2, 3, 4)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		types   string
+		sizes   []int
+		wantErr string
+	}{
+		{"two boxes", append(makeBox("ftyp", []byte("iso6")), makeBox("free")...), "ftyp free", []int{12, 8}, ""},
+		{"size 0 runs to the end", append(makeBox("free"), append(u32(0), []byte("mdat12345")...)...), "free mdat", []int{8, 13}, ""},
+		{"64-bit size", large, "mdat", []int{20}, ""},
+		{"empty", nil, "", nil, ""},
+		{"truncated header", []byte{0, 0, 0}, "", nil, "truncated box header"},
+		{"truncated large header", append(u32(1), []byte("mdat1234")...), "", nil, "truncated mdat box header"},
+		{"size past the end", append(u32(100), []byte("moov")...), "", nil, "invalid size for moov box"},
+		{"size below the header", append(u32(4), []byte("moov")...), "", nil, "invalid size for moov box"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boxes, err := readBoxes(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := boxTypes(boxes); got != tt.types {
+				t.Errorf("types = %q, want %q", got, tt.types)
+			}
+			for i, b := range boxes {
+				if len(b.data) != tt.sizes[i] {
+					t.Errorf("box %d is %d bytes, want %d", i, len(b.data), tt.sizes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeInits(t *testing.T) {
+	udta := makeBox("udta", []byte("first"))
+	video := initSegment(0, 7, "avc1", udta)
+	audio := initSegment(1, 3, "mp4a", makeBox("udta", []byte("second")))
+
+	out, err := mergeInits([][]byte{video, audio})
+	if err != nil {
+		t.Fatalf("mergeInits: %v", err)
+	}
+
+	top := mustBoxes(t, out)
+	if got := boxTypes(top); got != "ftyp moov" {
+		t.Fatalf("top level boxes = %q, want ftyp moov", got)
+	}
+	if !bytes.Equal(top[0].data, video[:len(top[0].data)]) {
+		t.Error("ftyp is not the first track's")
+	}
+	if len(top[1].data) != len(out)-len(top[0].data) {
+		t.Errorf("moov is %d bytes, want the rest of the %d", len(top[1].data), len(out))
+	}
+
+	moov := mustBoxes(t, top[1].payload())
+	if got := boxTypes(moov); got != "mvhd trak trak mvex udta" {
+		t.Fatalf("moov children = %q", got)
+	}
+	if next := binary.BigEndian.Uint32(moov[0].data[len(moov[0].data)-4:]); next != 3 {
+		t.Errorf("next_track_ID = %d, want 3", next)
+	}
+	for i, trak := range moov[1:3] {
+		tkhd, ok := findBox(mustBoxes(t, trak.payload()), "tkhd")
+		if !ok {
+			t.Fatalf("trak %d has no tkhd", i+1)
+		}
+		if id := trackID(t, tkhd); id != uint32(i+1) {
+			t.Errorf("trak %d has track_ID %d", i+1, id)
+		}
+	}
+	if tkhd, _ := findBox(mustBoxes(t, moov[2].payload()), "tkhd"); len(tkhd.data) != len(tkhdBox(1, 0)) {
+		t.Errorf("version 1 tkhd is %d bytes, want %d", len(tkhd.data), len(tkhdBox(1, 0)))
+	}
+
+	trexs := mustBoxes(t, moov[3].payload())
+	if got := boxTypes(trexs); got != "trex trex" {
+		t.Fatalf("mvex children = %q", got)
+	}
+	for i, trex := range trexs {
+		if id := trackID(t, trex); id != uint32(i+1) {
+			t.Errorf("trex %d has track_ID %d", i+1, id)
+		}
+	}
+	if !bytes.Equal(moov[4].data, udta) {
+		t.Error("udta is not the first track's")
+	}
+
+	// The inputs are not modified
+	if id := trackID(t, mustBoxes(t, mustBoxes(t, mustBoxes(t, video)[1].payload())[1].payload())[0]); id != 7 {
+		t.Errorf("input track_ID changed to %d", id)
+	}
+}
+
+func TestMergeInitsErrors(t *testing.T) {
+	noMvex := append(makeBox("ftyp", []byte("iso6")), makeBox("moov", mvhdBox(2), makeBox("trak", tkhdBox(0, 1)))...)
+	noTkhd := append(makeBox("ftyp", []byte("iso6")), makeBox("moov", mvhdBox(2), makeBox("trak", makeBox("mdia")), makeBox("mvex", trexBox(1)))...)
+
+	tests := []struct {
+		name  string
+		inits [][]byte
+		want  string
+	}{
+		{"encrypted video", [][]byte{initSegment(0, 1, "encv")}, "track 1 is encrypted (DRM), which is not supported"},
+		{"encrypted audio", [][]byte{initSegment(0, 1, "avc1"), initSegment(0, 2, "enca")}, "track 2 is encrypted (DRM), which is not supported"},
+		{"no moov", [][]byte{makeBox("ftyp", []byte("iso6"))}, "track 1 init segment has no moov box"},
+		{"not fragmented", [][]byte{noMvex}, "init segment is not a fragmented MP4"},
+		{"no tkhd", [][]byte{noTkhd}, "track 1 has no tkhd box"},
+		{"truncated", [][]byte{initSegment(0, 1, "avc1")[:40]}, "track 1 init segment: invalid size for moov box"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mergeInits(tt.inits)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// fragment builds a moof and mdat whose trun data offset points at the
+// first byte of the mdat payload, relative to the moof
+func fragment(sequence, trackID uint32, tfhdFlags uint32, payload string) []byte {
+	build := func(dataOffset uint32) []byte {
+		trun := fullBox("trun", 0, 0x000001, u32(1), u32(dataOffset))
+		traf := makeBox("traf", fullBox("tfhd", 0, tfhdFlags, u32(trackID)), fullBox("tfdt", 1, 0, make([]byte, 8)), trun)
+		return makeBox("moof", fullBox("mfhd", 0, 0, u32(sequence)), traf)
+	}
+	moof := build(0)
+	moof = build(uint32(len(moof) + 8))
+	return append(moof, makeBox("mdat", []byte(payload))...)
+}
+
+// dataOffset reads the data offset of the first trun in a moof
+func dataOffset(t *testing.T, moof box) uint32 {
+	t.Helper()
+	traf, _ := findBox(mustBoxes(t, moof.payload()), "traf")
+	trun, ok := findBox(mustBoxes(t, traf.payload()), "trun")
+	if !ok {
+		t.Fatal("no trun")
+	}
+	return binary.BigEndian.Uint32(trun.payload()[8:])
+}
+
+func TestRewriteFragments(t *testing.T) {
+	styp := makeBox("styp", []byte("msdh"), u32(0), []byte("msdhmsix"))
+	sidx := fullBox("sidx", 0, 0, make([]byte, 24))
+	segment := append(append(styp, sidx...), fragment(1, 5, 0x020000, "first sample")...)
+	segment = append(segment, fragment(2, 5, 0x020000, "second")...)
+
+	out, err := rewriteFragments(segment, 2, 768)
+	if err != nil {
+		t.Fatalf("rewriteFragments: %v", err)
+	}
+
+	boxes := mustBoxes(t, out)
+	if got := boxTypes(boxes); got != "moof mdat moof mdat" {
+		t.Fatalf("boxes = %q, want the fragments without styp and sidx", got)
+	}
+	if want := len(segment) - len(styp) - len(sidx); len(out) != want {
+		t.Errorf("output is %d bytes, want %d", len(out), want)
+	}
+
+	payloads := []string{"first sample", "second"}
+	for i := 0; i < 2; i++ {
+		moof, mdat := boxes[2*i], boxes[2*i+1]
+		children := mustBoxes(t, moof.payload())
+		mfhd, _ := findBox(children, "mfhd")
+		if seq := binary.BigEndian.Uint32(mfhd.payload()[4:]); seq != uint32(768+i) {
+			t.Errorf("fragment %d has sequence %d, want %d", i+1, seq, 768+i)
+		}
+		traf, _ := findBox(children, "traf")
+		tfhd, _ := findBox(mustBoxes(t, traf.payload()), "tfhd")
+		if id := trackID(t, tfhd); id != 2 {
+			t.Errorf("fragment %d has track_ID %d, want 2", i+1, id)
+		}
+
+		// Offsets are relative to the moof, so they still find the samples
+		start := bytes.Index(out, moof.data)
+		offset := int(dataOffset(t, moof))
+		if got := string(out[start+offset : start+offset+len(payloads[i])]); got != payloads[i] {
+			t.Errorf("fragment %d data offset finds %q, want %q", i+1, got, payloads[i])
+		}
+		if string(mdat.payload()) != payloads[i] {
+			t.Errorf("mdat %d holds %q", i+1, mdat.payload())
+		}
+	}
+}
+
+func TestRewriteFragmentsErrors(t *testing.T) {
+	badMfhd := append(makeBox("moof", makeBox("mfhd", []byte{0, 0})), makeBox("mdat")...)
+	noTfhd := append(makeBox("moof", fullBox("mfhd", 0, 0, u32(1)), makeBox("traf")), makeBox("mdat")...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"base data offset", fragment(1, 1, 0x000001, "x"), "fragments with an explicit base data offset are not supported"},
+		{"no fragments", makeBox("styp", []byte("msdh")), "segment has no movie fragments"},
+		{"truncated", fragment(1, 1, 0x020000, "x")[:20], "invalid size for moof box"},
+		{"truncated mfhd", badMfhd, "truncated mfhd box"},
+		{"no tfhd", noTfhd, "traf has no tfhd box"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rewriteFragments(tt.data, 1, 1)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Manifest is the playable content of an MPD: the video and audio
+// representations of its period, each with a resolved segment list
+type Manifest struct {
+	// Duration is the presentation length in seconds (0 if unknown)
+	Duration float64
+	Video    []Representation
+	Audio    []Representation
+}
+
+// Representation is one encoding of a track
+type Representation struct {
+	ID        string
+	Bandwidth int64
+	Width     int
+	Height    int
+	Codecs    string
+	Lang      string
+	// Init is the URL of the initialization segment
+	Init     string
+	Segments []Segment
+}
+
+// String describes the representation for display
+func (r Representation) String() string {
+	s := fmt.Sprintf("%.0f kbps", float64(r.Bandwidth)/1000)
+	if r.Height > 0 {
+		s = fmt.Sprintf("%dx%d, %s", r.Width, r.Height, s)
+	}
+	if r.Lang != "" {
+		s = r.Lang + ", " + s
+	}
+	if r.Codecs != "" {
+		s += " (" + r.Codecs + ")"
+	}
+	return s
+}
+
+// Segment is one media segment of a representation
+type Segment struct {
+	URI string
+	// Start is the presentation time of the segment in seconds
+	Start float64
+}
+
+// The subset of the MPD schema needed to list segments. Element names are
+// matched without their namespace.
+type mpdXML struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []periodXML `xml:"Period"`
+}
+
+type periodXML struct {
+	Duration       string             `xml:"duration,attr"`
+	BaseURL        string             `xml:"BaseURL"`
+	AdaptationSets []adaptationSetXML `xml:"AdaptationSet"`
+}
+
+type adaptationSetXML struct {
+	ContentType     string              `xml:"contentType,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	Lang            string              `xml:"lang,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *segmentTemplateXML `xml:"SegmentTemplate"`
+	SegmentList     *segmentListXML     `xml:"SegmentList"`
+	Protection      []struct{}          `xml:"ContentProtection"`
+	Representations []representationXML `xml:"Representation"`
+}
+
+type representationXML struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       int64               `xml:"bandwidth,attr"`
+	Width           int                 `xml:"width,attr"`
+	Height          int                 `xml:"height,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *segmentTemplateXML `xml:"SegmentTemplate"`
+	SegmentList     *segmentListXML     `xml:"SegmentList"`
+	Protection      []struct{}          `xml:"ContentProtection"`
+}
+
+type segmentTemplateXML struct {
+	Media                  string       `xml:"media,attr"`
+	Initialization         string       `xml:"initialization,attr"`
+	StartNumber            *int64       `xml:"startNumber,attr"`
+	Timescale              *int64       `xml:"timescale,attr"`
+	Duration               *int64       `xml:"duration,attr"`
+	PresentationTimeOffset *int64       `xml:"presentationTimeOffset,attr"`
+	Timeline               *timelineXML `xml:"SegmentTimeline"`
+}
+
+type timelineXML struct {
+	S []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int64  `xml:"r,attr"`
+	} `xml:"S"`
+}
+
+type segmentListXML struct {
+	Timescale      *int64 `xml:"timescale,attr"`
+	Duration       *int64 `xml:"duration,attr"`
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// Parse reads an MPD manifest. Relative URLs are resolved against base.
+// Only static (on-demand) manifests with a single period and segments
+// described by SegmentTemplate or SegmentList are supported.
+func Parse(r io.Reader, base *url.URL) (*Manifest, error) {
+	var doc mpdXML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not a DASH manifest: %v", err)
+	}
+	if doc.Type == "dynamic" {
+		return nil, fmt.Errorf("live DASH streams are not supported")
+	}
+	if len(doc.Periods) == 0 {
+		return nil, fmt.Errorf("manifest has no periods")
+	}
+	if len(doc.Periods) > 1 {
+		return nil, fmt.Errorf("manifests with %d periods are not supported", len(doc.Periods))
+	}
+	period := doc.Periods[0]
+
+	manifest := &Manifest{}
+	duration := period.Duration
+	if duration == "" {
+		duration = doc.Duration
+	}
+	if duration != "" {
+		seconds, err := parseDuration(duration)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Duration = seconds
+	}
+
+	base, err := resolveBase(base, doc.BaseURL, period.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range period.AdaptationSets {
+		setBase, err := resolveBase(base, set.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rep := range set.Representations {
+			kind := contentKind(set.ContentType, rep.MimeType, set.MimeType)
+			if kind != "video" && kind != "audio" {
+				continue
+			}
+			if len(set.Protection) > 0 || len(rep.Protection) > 0 {
+				return nil, fmt.Errorf("representation %s is encrypted (DRM), which is not supported", rep.ID)
+			}
+			mimeType := rep.MimeType
+			if mimeType == "" {
+				mimeType = set.MimeType
+			}
+			if mimeType != "" && !strings.HasSuffix(mimeType, "/mp4") {
+				return nil, fmt.Errorf("representation %s is %s, only MP4 is supported", rep.ID, mimeType)
+			}
+
+			codecs := rep.Codecs
+			if codecs == "" {
+				codecs = set.Codecs
+			}
+			out := Representation{
+				ID:        rep.ID,
+				Bandwidth: rep.Bandwidth,
+				Width:     rep.Width,
+				Height:    rep.Height,
+				Codecs:    codecs,
+				Lang:      set.Lang,
+			}
+
+			repBase, err := resolveBase(setBase, rep.BaseURL)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case rep.SegmentTemplate != nil || set.SegmentTemplate != nil:
+				tmpl := mergeTemplates(set.SegmentTemplate, rep.SegmentTemplate)
+				err = tmpl.expand(&out, repBase, manifest.Duration)
+			case rep.SegmentList != nil || set.SegmentList != nil:
+				list := rep.SegmentList
+				if list == nil {
+					list = set.SegmentList
+				}
+				err = list.expand(&out, repBase, manifest.Duration)
+			default:
+				err = fmt.Errorf("representation %s has no segment template or list (single-file SegmentBase streams are not supported)", rep.ID)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if kind == "video" {
+				manifest.Video = append(manifest.Video, out)
+			} else {
+				manifest.Audio = append(manifest.Audio, out)
+			}
+		}
+	}
+
+	if len(manifest.Video) == 0 && len(manifest.Audio) == 0 {
+		return nil, fmt.Errorf("manifest has no audio or video representations")
+	}
+	return manifest, nil
+}
+
+// contentKind returns "video", "audio" or something else for a track
+func contentKind(contentType string, mimeTypes ...string) string {
+	if contentType != "" {
+		return contentType
+	}
+	for _, mimeType := range mimeTypes {
+		if kind, _, ok := strings.Cut(mimeType, "/"); ok {
+			return kind
+		}
+	}
+	return ""
+}
+
+// mergeTemplates applies representation-level template attributes on top
+// of those inherited from the adaptation set
+func mergeTemplates(set, rep *segmentTemplateXML) segmentTemplateXML {
+	var merged segmentTemplateXML
+	if set != nil {
+		merged = *set
+	}
+	if rep == nil {
+		return merged
+	}
+	if rep.Media != "" {
+		merged.Media = rep.Media
+	}
+	if rep.Initialization != "" {
+		merged.Initialization = rep.Initialization
+	}
+	if rep.StartNumber != nil {
+		merged.StartNumber = rep.StartNumber
+	}
+	if rep.Timescale != nil {
+		merged.Timescale = rep.Timescale
+	}
+	if rep.Duration != nil {
+		merged.Duration = rep.Duration
+	}
+	if rep.PresentationTimeOffset != nil {
+		merged.PresentationTimeOffset = rep.PresentationTimeOffset
+	}
+	if rep.Timeline != nil {
+		merged.Timeline = rep.Timeline
+	}
+	return merged
+}
+
+// expand lists the segments of a SegmentTemplate, either from its
+// SegmentTimeline or from a fixed segment duration
+func (t segmentTemplateXML) expand(rep *Representation, base *url.URL, total float64) error {
+	if t.Media == "" {
+		return fmt.Errorf("representation %s has a segment template without media", rep.ID)
+	}
+	timescale := valueOr(t.Timescale, 1)
+	number := valueOr(t.StartNumber, 1)
+	offset := valueOr(t.PresentationTimeOffset, 0)
+
+	var err error
+	if t.Initialization != "" {
+		if rep.Init, err = resolve(base, fillTemplate(t.Initialization, rep, 0, 0)); err != nil {
+			return err
+		}
+	}
+
+	add := func(number, time int64) error {
+		uri, err := resolve(base, fillTemplate(t.Media, rep, number, time))
+		if err != nil {
+			return err
+		}
+		rep.Segments = append(rep.Segments, Segment{
+			URI:   uri,
+			Start: float64(time-offset) / float64(timescale),
+		})
+		return nil
+	}
+
+	if t.Timeline != nil {
+		var time int64
+		for i, s := range t.Timeline.S {
+			if s.T != nil {
+				time = *s.T
+			}
+			if s.D <= 0 {
+				return fmt.Errorf("representation %s has a segment without duration", rep.ID)
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next S element or the end of the period
+				end := int64(math.Ceil(total*float64(timescale))) + offset
+				if i+1 < len(t.Timeline.S) && t.Timeline.S[i+1].T != nil {
+					end = *t.Timeline.S[i+1].T
+				}
+				repeat = (end-time+s.D-1)/s.D - 1
+			}
+			for r := int64(0); r <= repeat; r++ {
+				if err := add(number, time); err != nil {
+					return err
+				}
+				number++
+				time += s.D
+			}
+		}
+		return nil
+	}
+
+	duration := valueOr(t.Duration, 0)
+	if duration <= 0 || total <= 0 {
+		return fmt.Errorf("representation %s: cannot count segments without a timeline or durations", rep.ID)
+	}
+	count := int64(math.Ceil(total * float64(timescale) / float64(duration)))
+	for i := int64(0); i < count; i++ {
+		if err := add(number+i, offset+i*duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand lists the segments of a SegmentList
+func (l segmentListXML) expand(rep *Representation, base *url.URL, total float64) error {
+	var err error
+	if l.Initialization != nil && l.Initialization.SourceURL != "" {
+		if rep.Init, err = resolve(base, l.Initialization.SourceURL); err != nil {
+			return err
+		}
+	}
+
+	// Without a duration, spread the segments evenly over the period
+	step := 1.0
+	if d := valueOr(l.Duration, 0); d > 0 {
+		step = float64(d) / float64(valueOr(l.Timescale, 1))
+	} else if total > 0 && len(l.SegmentURLs) > 0 {
+		step = total / float64(len(l.SegmentURLs))
+	}
+
+	for i, s := range l.SegmentURLs {
+		uri, err := resolve(base, s.Media)
+		if err != nil {
+			return err
+		}
+		rep.Segments = append(rep.Segments, Segment{URI: uri, Start: float64(i) * step})
+	}
+	return nil
+}
+
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0\d+d)?\$|\$\$`)
+
+// fillTemplate substitutes the $Identifier$ placeholders of a segment template
+func fillTemplate(tmpl string, rep *Representation, number, time int64) string {
+	return templateIdentifier.ReplaceAllStringFunc(tmpl, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		parts := templateIdentifier.FindStringSubmatch(match)
+		format := "%d"
+		if parts[2] != "" {
+			format = parts[2]
+		}
+		switch parts[1] {
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			return fmt.Sprintf(format, number)
+		case "Time":
+			return fmt.Sprintf(format, time)
+		default:
+			return fmt.Sprintf(format, rep.Bandwidth)
+		}
+	})
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseDuration reads an ISO 8601 duration such as "PT1H2M3.5S" in seconds
+func parseDuration(s string) (float64, error) {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var seconds float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		seconds += value * unit
+	}
+	return seconds, nil
+}
+
+// resolveBase applies nested BaseURL elements in order
+func resolveBase(base *url.URL, refs ...string) (*url.URL, error) {
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BaseURL %q: %v", ref, err)
+		}
+		base = base.ResolveReference(u)
+	}
+	return base, nil
+}
+
+// resolve makes a segment URL absolute
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := resolveBase(base, ref)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func valueOr(v *int64, fallback int64) int64 {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
@@ -0,0 +1,219 @@
+package dash
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// manifestURL is where the fixtures are pretended to come from
+var manifestURL, _ = url.Parse("https://cdn.example.com/show/manifest.mpd")
+
+func parseFixture(t *testing.T, name string) (*Manifest, error) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return Parse(f, manifestURL)
+}
+
+// segments builds the expected segments from URLs and start times
+func segments(prefix string, uris []string, starts ...float64) []Segment {
+	var out []Segment
+	for i, uri := range uris {
+		out = append(out, Segment{URI: prefix + uri, Start: starts[i]})
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *Manifest
+	}{
+		{
+			// SegmentTemplate with a fixed duration, inherited from the
+			// adaptation set and partly overridden per representation
+			fixture: "template_number.mpd",
+			want: &Manifest{
+				Duration: 10,
+				Video: []Representation{
+					{
+						ID: "v720", Bandwidth: 2400000, Width: 1280, Height: 720, Codecs: "avc1.64001f",
+						Init:     "https://cdn.example.com/show/video/v720/init.mp4",
+						Segments: segments("https://cdn.example.com/show/video/v720/", []string{"seg-00001.m4s", "seg-00002.m4s", "seg-00003.m4s"}, 0, 4, 8),
+					},
+					{
+						ID: "v1080", Bandwidth: 4800000, Width: 1920, Height: 1080, Codecs: "avc1.640028",
+						Init:     "https://cdn.example.com/show/video/v1080/init.mp4",
+						Segments: segments("https://cdn.example.com/show/video/v1080/", []string{"seg-00010.m4s", "seg-00011.m4s", "seg-00012.m4s"}, 0, 4, 8),
+					},
+				},
+				Audio: []Representation{
+					{
+						ID: "a128", Bandwidth: 128000, Codecs: "mp4a.40.2", Lang: "en",
+						Init:     "https://audio.example.com/a128/init.mp4",
+						Segments: segments("https://audio.example.com/a128/128000/", []string{"1.m4s"}, 0),
+					},
+				},
+			},
+		},
+		{
+			// SegmentTimeline with repeats, a presentation time offset and
+			// a repeat count of -1 that runs to the end of the period
+			fixture: "template_timeline.mpd",
+			want: &Manifest{
+				Duration: 5,
+				Video: []Representation{
+					{
+						ID: "video", Bandwidth: 1000000, Width: 960, Height: 540,
+						Init:     "https://media.example.com/feature/video_init.mp4",
+						Segments: segments("https://media.example.com/feature/", []string{"video_9000.m4s", "video_189000.m4s", "video_369000.m4s"}, 0, 2, 4),
+					},
+				},
+				Audio: []Representation{
+					{
+						ID: "audio", Bandwidth: 96000, Lang: "de",
+						Init:     "https://media.example.com/feature/audio/init.mp4",
+						Segments: segments("https://media.example.com/feature/audio/", []string{"0000000000.m4s", "0000096000.m4s", "0000192000.m4s"}, 0, 2, 4),
+					},
+				},
+			},
+		},
+		{
+			// SegmentList with and without a segment duration
+			fixture: "segment_list.mpd",
+			want: &Manifest{
+				Duration: 9,
+				Video: []Representation{
+					{
+						ID: "1", Bandwidth: 500000, Width: 640, Height: 360,
+						Init:     "https://cdn.example.com/lists/360p/init.mp4",
+						Segments: segments("https://cdn.example.com/lists/360p/", []string{"one.m4s", "two.m4s", "three.m4s"}, 0, 4, 8),
+					},
+				},
+				Audio: []Representation{
+					{
+						ID: "2", Bandwidth: 64000,
+						Init:     "https://cdn.example.com/show/audio/init.mp4",
+						Segments: segments("https://cdn.example.com/show/audio/", []string{"1.m4s", "2.m4s", "3.m4s"}, 0, 3, 6),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := parseFixture(t, tt.fixture)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got.Duration != tt.want.Duration {
+				t.Errorf("Duration = %v, want %v", got.Duration, tt.want.Duration)
+			}
+			if !reflect.DeepEqual(got.Video, tt.want.Video) {
+				t.Errorf("Video:\ngot  %+v\nwant %+v", got.Video, tt.want.Video)
+			}
+			if !reflect.DeepEqual(got.Audio, tt.want.Audio) {
+				t.Errorf("Audio:\ngot  %+v\nwant %+v", got.Audio, tt.want.Audio)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{"segment_base.mpd", "representation single has no segment template or list (single-file SegmentBase streams are not supported)"},
+		{"live.mpd", "live DASH streams are not supported"},
+		{"drm.mpd", "representation protected is encrypted (DRM), which is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			_, err := parseFixture(t, tt.fixture)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	period := func(inner string) string {
+		return `<MPD type="static" mediaPresentationDuration="PT4S"><Period>` + inner + `</Period></MPD>`
+	}
+	tests := []struct {
+		name string
+		mpd  string
+		want string
+	}{
+		{"not XML", "#EXTM3U", "not a DASH manifest"},
+		{"no periods", `<MPD type="static"></MPD>`, "manifest has no periods"},
+		{"two periods", `<MPD><Period/><Period/></MPD>`, "manifests with 2 periods are not supported"},
+		{"bad duration", `<MPD mediaPresentationDuration="4 seconds"><Period/></MPD>`, `invalid duration "4 seconds"`},
+		{"no tracks", period(`<AdaptationSet contentType="text"><Representation id="t"/></AdaptationSet>`), "manifest has no audio or video representations"},
+		{"WebM", period(`<AdaptationSet mimeType="video/webm"><SegmentTemplate media="$Number$.webm" duration="2"/><Representation id="w"/></AdaptationSet>`), "representation w is video/webm, only MP4 is supported"},
+		{"template without media", period(`<AdaptationSet mimeType="video/mp4"><SegmentTemplate duration="2"/><Representation id="v"/></AdaptationSet>`), "representation v has a segment template without media"},
+		{"template without duration", period(`<AdaptationSet mimeType="video/mp4"><SegmentTemplate media="$Number$.m4s"/><Representation id="v"/></AdaptationSet>`), "representation v: cannot count segments without a timeline or durations"},
+		{"timeline without duration", period(`<AdaptationSet mimeType="video/mp4"><SegmentTemplate media="$Time$.m4s"><SegmentTimeline><S t="0"/></SegmentTimeline></SegmentTemplate><Representation id="v"/></AdaptationSet>`), "representation v has a segment without duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.mpd), manifestURL)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	rep := &Representation{ID: "v1", Bandwidth: 800000}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"$RepresentationID$/$Number$.m4s", "v1/7.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00007.m4s"},
+		{"$Time$.m4s", "90000.m4s"},
+		{"$Time%012d$.m4s", "000000090000.m4s"},
+		{"$Bandwidth$/$Number%03d$", "800000/007"},
+		{"price$$-$Number$", "price$-7"},
+		{"$Unknown$-$Number$", "$Unknown$-7"},
+	}
+	for _, tt := range tests {
+		if got := fillTemplate(tt.tmpl, rep, 7, 90000); got != tt.want {
+			t.Errorf("fillTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"PT10S", 10, false},
+		{"PT1H2M3.5S", 3723.5, false},
+		{"P1DT1S", 86401, false},
+		{"PT0.25S", 0.25, false},
+		{"P", 0, false},
+		{"10S", 0, true},
+		{"PT1X", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package datafile writes the JSON files tt6d keeps between runs, such as
+// the download history and the watch list, and finds where they live
+package datafile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir returns $XDG_DATA_HOME/tt6d, falling back to ~/.local/share/tt6d when
+// XDG_DATA_HOME is not set, or "" if there is no home folder
+func Dir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "tt6d")
+}
+
+// Path returns the path of a file in Dir, or "" if there is no data folder
+func Path(name string) string {
+	dir := Dir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// WriteJSON writes v as indented JSON atomically, through a temporary file
+// that is renamed over path, so a crash never leaves it half written. The
+// folder is created if needed.
+func WriteJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %v", err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+const (
+	// lockPoll is how often a held lock is tried again
+	lockPoll = 50 * time.Millisecond
+	// lockTimeout is how long Lock waits before giving up
+	lockTimeout = 10 * time.Second
+	// staleLock is the age after which a lock is taken to be left behind by
+	// a process that died. Locks are only held for a read and a write.
+	staleLock = 30 * time.Second
+)
+
+// Lock takes a lock on path between processes, using a path.lock file
+// created exclusively. It waits while another process holds the lock and
+// returns a function that releases it.
+func Lock(path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %v", err)
+	}
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another tt6d; remove %s if none is running", path, lockPath)
+		}
+		time.Sleep(lockPoll)
+	}
+}
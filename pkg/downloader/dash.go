@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"context"
+	"io"
+
+	"tt6d/pkg/dash"
+)
+
+// downloadDASH downloads the chosen video and audio representations of a
+// DASH manifest and muxes them into a single fragmented .mp4 file
+func downloadDASH(ctx context.Context, job Job, link, downloadFolder string, index, totalFiles, attempt int, opts Options) error {
+	fetch := opts.fetch
+	manifest, err := dash.Load(ctx, fetch, link)
+	if err != nil {
+		return err
+	}
+
+	stream, err := dash.Select(manifest, opts.quality(job))
+	if err != nil {
+		return err
+	}
+
+	run := func(w io.Writer, concurrency, start int, done func(int, int64)) error {
+		return stream.Download(ctx, w, dash.Options{
+			Concurrency: concurrency,
+			Fetch:       fetch,
+			Start:       start,
+			OnSegment:   done,
+		})
+	}
+	name := streamFilename(link, ".mp4")
+	source := link + "#" + stream.ID()
+	return downloadStream(ctx, job, downloadFolder, name, source, stream.Len(),
+		index, totalFiles, attempt, opts, run)
+}
@@ -1,36 +1,119 @@
 package downloader
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
 	"sync"
+	"time"
 
+	"tt6d/pkg/dash"
+	"tt6d/pkg/hls"
 	"tt6d/pkg/progress"
+	"tt6d/pkg/ratelimit"
 )
 
-// Download downloads multiple files
-func Download(links []string, downloadFolder string, concurrentDownloads int) error {
-	// Clear screen and hide cursor
-	fmt.Print("\033[2J\033[H\033[?25l")
-	defer fmt.Print("\033[?25h") // Show cursor when done
+// Job is a single file to download. The series fields are optional and
+// are used to fill in the naming template.
+type Job struct {
+	URL string `json:"url"`
+	// Mirrors are alternative URLs for the same file, tried in order when
+	// URL fails. Only one copy is saved.
+	Mirrors   []string `json:"mirrors,omitempty"`
+	Series    string   `json:"series,omitempty"`
+	EpisodeID string   `json:"episode_id,omitempty"` // e.g. "S01E01"
+	Season    int      `json:"season,omitempty"`
+	Episode   int      `json:"episode,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	// QualityTag describes the release, e.g. "720p x265"
+	QualityTag string `json:"quality_tag,omitempty"`
+	// Size is the size listed on the page in bytes. It is approximate and
+	// only used to catch wrong files.
+	Size int64 `json:"size,omitempty"`
+	// Quality overrides Options.Quality for this job
+	Quality string `json:"quality,omitempty"`
+	// Page is the web page the links were found on
+	Page string `json:"page,omitempty"`
+}
+
+// Options controls how files are downloaded
+type Options struct {
+	// ConcurrentDownloads is the number of files downloaded at the same time
+	ConcurrentDownloads int
+	// Connections is the number of parallel connections used for a single file.
+	// Values above 1 split the file into byte ranges if the server supports it.
+	Connections int
+	// Retry controls how transient failures are retried
+	Retry RetryPolicy
+	// Limiter caps the combined bandwidth of all downloads (nil = unlimited)
+	Limiter *ratelimit.Limiter
+	// DiscardPartial deletes unfinished .part files on cancellation
+	// instead of keeping them for a later resume
+	DiscardPartial bool
+	// OnExisting decides what to do when the target file already exists
+	// (defaults to PolicySkip)
+	OnExisting ExistingPolicy
+	// Template names episode files; nil keeps the server's filename
+	Template *Template
+	// Quality picks the variant of HLS and DASH streams: best, worst,
+	// a height such as 720p, or a bandwidth in bits per second
+	Quality string
+	// Journal, if set, records the state of every job so an interrupted
+	// queue can be continued later
+	Journal *Journal
+	// Resolve, if set, turns a link into a direct download URL before each
+	// attempt. It is given the job's Page.
+	Resolve func(ctx context.Context, page, link string) (string, error)
+	// OnComplete, if set, is called with the final path of every finished file,
+	// after the download has freed its slot for the next one. It may be called
+	// from several goroutines at once.
+	OnComplete func(job Job, filePath string)
+}
 
-	// Create empty progress bars
-	for i := 0; i < concurrentDownloads; i++ {
-		fmt.Println()
+// Download downloads multiple files. Cancelling ctx stops all transfers;
+// unfinished files are kept as .part files for resume unless
+// Options.DiscardPartial is set.
+func Download(ctx context.Context, jobs []Job, downloadFolder string, opts Options) (*Summary, error) {
+	concurrentDownloads := opts.ConcurrentDownloads
+	if concurrentDownloads < 1 {
+		concurrentDownloads = 1
+	}
+	if opts.OnExisting == "" {
+		opts.OnExisting = PolicySkip
 	}
 
+	if progress.Interactive {
+		// Clear screen and hide cursor
+		fmt.Print("\033[2J\033[H\033[?25l")
+		defer fmt.Print("\033[?25h") // Show cursor when done
+
+		// Create empty progress bars
+		for i := 0; i < concurrentDownloads; i++ {
+			fmt.Println()
+		}
+	}
+
+	if err := opts.Journal.Add(jobs); err != nil {
+		return nil, err
+	}
+	defer opts.Journal.track()()
+
+	summary := &Summary{}
 	if concurrentDownloads == 1 {
 		// Sequential download
-		for i, link := range links {
-			if err := downloadFile(link, downloadFolder, i+1, len(links)); err != nil {
-				fmt.Printf("\n[%d/%d] Error downloading %s: %v\n", i+1, len(links), link, err)
+		for i, job := range jobs {
+			if ctx.Err() != nil {
+				summary.add(job.URL, ctx.Err())
+				continue
 			}
+			err := downloadFile(ctx, job, downloadFolder, i+1, len(jobs), opts)
+			if err != nil && err != ErrSkipped && ctx.Err() == nil {
+				fmt.Printf("\n[%d/%d] Error downloading %s: %v\n", i+1, len(jobs), job.URL, err)
+			}
+			summary.add(job.URL, err)
 		}
 	} else {
 		// Concurrent download
@@ -39,11 +122,16 @@ func Download(links []string, downloadFolder string, concurrentDownloads int) er
 		activeSlots := make([]bool, concurrentDownloads)
 		var mutex sync.Mutex
 
-		for i, link := range links {
+		for i, job := range jobs {
 			wg.Add(1)
-			go func(index int, mp4URL string) {
+			go func(index int, job Job) {
 				defer wg.Done()
-				semaphore <- struct{}{}
+				select {
+				case semaphore <- struct{}{}:
+				case <-ctx.Done():
+					summary.add(job.URL, ctx.Err())
+					return
+				}
 
 				// Find an available slot
 				mutex.Lock()
@@ -57,95 +145,377 @@ func Download(links []string, downloadFolder string, concurrentDownloads int) er
 				}
 				mutex.Unlock()
 
+				// OnComplete may be slow, hashing the file for the history, so
+				// it is held back until the slot is free
+				var finished func()
+				jobOpts := opts
+				if opts.OnComplete != nil {
+					jobOpts.OnComplete = func(job Job, filePath string) {
+						finished = func() { opts.OnComplete(job, filePath) }
+					}
+				}
+
 				// Use slot number + 1 as display line
-				if err := downloadFile(mp4URL, downloadFolder, slotID+1, len(links)); err != nil {
-					fmt.Printf("\033[%d;0H\033[K[%d/%d] Error downloading %s: %v",
-						slotID+1, index+1, len(links), mp4URL, err)
+				err := downloadFile(ctx, job, downloadFolder, slotID+1, len(jobs), jobOpts)
+				if err != nil && err != ErrSkipped && ctx.Err() == nil {
+					progress.PrintStatus(slotID+1, "[%d/%d] Error downloading %s: %v",
+						index+1, len(jobs), job.URL, err)
 				}
+				summary.add(job.URL, err)
 
 				mutex.Lock()
 				activeSlots[slotID] = false // Free up the slot
 				mutex.Unlock()
 
 				<-semaphore
-			}(i, link)
+				if finished != nil {
+					finished()
+				}
+			}(i, job)
 		}
 
 		wg.Wait()
 	}
 
 	// Move cursor to bottom of progress area and print completion message
-	fmt.Printf("\033[%d;0H\nAll downloads completed!\n", concurrentDownloads+1)
-	return nil
+	if progress.Interactive {
+		fmt.Printf("\033[%d;0H\n", concurrentDownloads+1)
+	}
+	if ctx.Err() != nil {
+		return summary, ctx.Err()
+	}
+	if len(summary.Failed) == 0 {
+		fmt.Println("All downloads completed!")
+	}
+	return summary, nil
+}
+
+// links returns the URL of a job followed by its mirrors
+func (job Job) links() []string {
+	return append([]string{job.URL}, job.Mirrors...)
+}
+
+// downloadFile downloads a single file, moving on to the next mirror when
+// one fails for good
+func downloadFile(ctx context.Context, job Job, downloadFolder string, index, totalFiles int, opts Options) (err error) {
+	defer func() { opts.Journal.finish(job.URL, err) }()
+
+	links := job.links()
+	for i, link := range links {
+		err = downloadMirror(ctx, job, link, downloadFolder, index, totalFiles, opts)
+		if err == nil || err == ErrSkipped || ctx.Err() != nil {
+			return err
+		}
+		if i < len(links)-1 {
+			progress.PrintStatus(index, "[%d/%d] Mirror %d/%d failed: %v - trying the next one",
+				index, totalFiles, i+1, len(links), err)
+		}
+	}
+	if len(links) > 1 {
+		return fmt.Errorf("%w (all %d mirrors failed)", err, len(links))
+	}
+	return err
+}
+
+// downloadMirror downloads a file from one of its links, retrying transient
+// failures with exponential backoff. Each retry resumes from the .part file.
+func downloadMirror(ctx context.Context, job Job, link, downloadFolder string, index, totalFiles int, opts Options) error {
+	policy := opts.Retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := downloadAttempt(ctx, job, link, downloadFolder, index, totalFiles, attempt, opts)
+		if err == nil {
+			return nil
+		}
+		if err == ErrSkipped {
+			progress.PrintStatus(index, "[%d/%d] %s: already downloaded, skipping", index, totalFiles, job.URL)
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= policy.MaxAttempts || !isTransient(err) {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+
+		delay := policy.backoff(attempt, err)
+		progress.PrintStatus(index, "[%d/%d] Attempt %d/%d failed: %v - retrying in %s",
+			index, totalFiles, attempt, policy.MaxAttempts, err, delay.Round(100*time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
-// downloadFile downloads a single file with progress tracking
-func downloadFile(fileURL, downloadFolder string, index, totalFiles int) error {
-	// Get the file
-	resp, err := http.Get(fileURL)
+// downloadAttempt makes one attempt at downloading a file from link with
+// progress tracking. Data is written to a .part file first and only renamed
+// to the final name once complete, so an interrupted download can be
+// resumed later.
+func downloadAttempt(ctx context.Context, job Job, link, downloadFolder string, index, totalFiles, attempt int, opts Options) error {
+	if opts.Resolve != nil {
+		resolved, err := opts.Resolve(ctx, job.Page, link)
+		if err != nil {
+			return fmt.Errorf("failed to resolve link: %w", err)
+		}
+		link = resolved
+	}
+
+	if hls.IsPlaylistURL(link) {
+		return downloadHLS(ctx, job, link, downloadFolder, index, totalFiles, attempt, opts)
+	}
+	if dash.IsManifestURL(link) {
+		return downloadDASH(ctx, job, link, downloadFolder, index, totalFiles, attempt, opts)
+	}
+
+	fileURL := link
+	filename, err := filenameFromURL(fileURL)
 	if err != nil {
-		return fmt.Errorf("failed to download file: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("file download returned status code: %d", resp.StatusCode)
+	// Ask the server for size, range support and its preferred filename.
+	// Servers that reject HEAD are still downloaded with a plain GET.
+	remote, probeErr := probe(ctx, fileURL)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	// Extract filename from URL
-	parsedURL, err := url.Parse(fileURL)
+	reqCtx, wrapBody, stop := newStallRequest(ctx, opts.Retry.StallTimeout)
+	defer stop()
+
+	// Some hosts reject HEAD or only name the file in the GET response, so
+	// ask for the first byte now to pick the right name. A server that
+	// ignores the range sends the whole file, whose body is used unless a
+	// .part file is continued.
+	var early *http.Response
+	if remote == nil || !remote.Named {
+		info, resp, err := probeGet(reqCtx, fileURL)
+		if err != nil {
+			return err
+		}
+		if resp != nil {
+			defer resp.Body.Close()
+			early = resp
+		}
+
+		switch {
+		case info == nil:
+		case remote == nil:
+			remote = info
+		case info.Named:
+			remote.Filename, remote.Named = info.Filename, true
+		}
+	}
+
+	if remote != nil && isWebPage(remote.ContentType) {
+		return errNotVideo
+	}
+	if remote != nil {
+		if err := checkSize(job, remote.Size); err != nil {
+			return err
+		}
+	}
+	if remote != nil && remote.Filename != "" {
+		filename = remote.Filename
+	}
+
+	// Decide what to do if the file is already there
+	filePath := filepath.Join(downloadFolder, localName(job, filename, opts.Template))
+	filePath, err = applyPolicy(ctx, fileURL, filePath, remote, job.Size, opts.OnExisting)
 	if err != nil {
-		return fmt.Errorf("failed to parse file URL: %v", err)
+		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %v", err)
+	}
+	filename = filepath.Base(filePath)
+	partPath := filePath + partSuffix
+	opts.Journal.start(job.URL, filePath)
+
+	// On cancellation the .part file is kept for resume unless asked otherwise
+	defer func() {
+		if ctx.Err() != nil && opts.DiscardPartial {
+			removePart(partPath)
+		}
+	}()
 
-	filename := path.Base(parsedURL.Path)
-	if filename == "." || filename == "/" {
-		filename = "video.mp4" // fallback filename
+	// Use several connections if requested, or to continue a segmented .part file
+	meta := loadPartMeta(partPath)
+	if opts.Connections > 1 || (meta != nil && len(meta.Segments) > 0) {
+		if early != nil {
+			// Only its headers were needed
+			early.Body.Close()
+			early = nil
+		}
+		// Don't give up on segments that are already on disk over a flaky probe
+		if probeErr != nil && isTransient(probeErr) && meta != nil {
+			return probeErr
+		}
+		err := downloadSegmented(ctx, fileURL, partPath, filename, remote, index, totalFiles, attempt, opts)
+		if err == nil {
+			return complete(job, partPath, filePath, opts)
+		}
+		if err != errNotSegmentable {
+			return err
+		}
 	}
 
-	// Ensure filename ends with .mp4
-	if !strings.HasSuffix(strings.ToLower(filename), ".mp4") {
-		filename += ".mp4"
+	// A segmented .part file has holes, so it cannot be continued as one stream
+	if meta != nil && len(meta.Segments) > 0 {
+		removePart(partPath)
+		meta = nil
 	}
 
-	// Create full file path
-	filePath := filepath.Join(downloadFolder, filename)
+	// Continue from an existing .part file if we know how to validate it
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && meta != nil && meta.Validator != "" {
+		offset = info.Size()
+	}
 
-	// Handle duplicate filenames
-	counter := 1
-	originalPath := filePath
-	for {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			break
+	// Get the file, or the rest of it
+	resp := early
+	if offset > 0 || resp == nil {
+		if early != nil {
+			early.Body.Close()
+		}
+		var validator string
+		if offset > 0 {
+			validator = meta.Validator
+		}
+		resp, err = get(reqCtx, fileURL, offset, validator)
+		if err != nil {
+			return err
 		}
-		// File exists, create a new name
-		ext := filepath.Ext(originalPath)
-		base := strings.TrimSuffix(originalPath, ext)
-		filePath = fmt.Sprintf("%s_%d%s", base, counter, ext)
-		counter++
+		defer resp.Body.Close()
 	}
 
-	// Create the file
-	out, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %v", err)
+	if resp.StatusCode/100 == 2 && isWebPage(resp.Header.Get("Content-Type")) {
+		return errNotVideo
+	}
+
+	var out *os.File
+	var total int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != offset {
+			return fmt.Errorf("server resumed at byte %d, expected %d", start, offset)
+		}
+		total = size
+		if total < 0 && resp.ContentLength > 0 {
+			total = offset + resp.ContentLength
+		}
+		out, err = os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open partial file: %v", err)
+		}
+
+	case http.StatusOK:
+		// Either a fresh download or the file changed on the server
+		offset = 0
+		total = resp.ContentLength
+		out, err = os.Create(partPath)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %v", err)
+		}
+		if err := savePartMeta(partPath, &partMeta{URL: fileURL, Validator: validatorFromResponse(resp)}); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to save resume data: %v", err)
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The .part file may already hold the whole file
+		if _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && size == offset {
+			return complete(job, partPath, filePath, opts)
+		}
+		removePart(partPath)
+		resp.Body.Close()
+		return downloadAttempt(ctx, job, link, downloadFolder, index, totalFiles, attempt, opts)
+
+	default:
+		return newStatusError(resp)
 	}
-	defer out.Close()
 
 	// Get content length for progress tracking
-	contentLength := resp.ContentLength
-	if contentLength <= 0 {
-		contentLength = 0 // Unknown size
+	if total <= 0 {
+		total = 0 // Unknown size
 	}
 
 	// Create progress writer
-	progressWriter := progress.New(out, contentLength, filename, index, totalFiles)
+	progressWriter := progress.New(out, total, filename, index, totalFiles)
+	progressWriter.SetOffset(offset)
+	progressWriter.SetAttempt(attempt, opts.Retry.MaxAttempts)
 
 	// Copy the response body to file with progress tracking
-	_, err = io.Copy(progressWriter, resp.Body)
+	written, err := io.Copy(progressWriter, opts.Limiter.Reader(ctx, wrapBody(resp.Body)))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to save file: %v", err)
+		return fmt.Errorf("failed to save file: %w", err)
 	}
 
+	if total > 0 && offset+written != total {
+		return fmt.Errorf("%w: got %d of %d bytes", errIncomplete, offset+written, total)
+	}
+	if total == 0 {
+		// The server didn't say how big the file is, so compare with the page
+		if err := checkSize(job, offset+written); err != nil {
+			removePart(partPath)
+			return err
+		}
+	}
+
+	progressWriter.Done()
+	return complete(job, partPath, filePath, opts)
+}
+
+// get requests a file, from offset onwards if offset is above 0, unless it
+// changed since validator
+func get(ctx context.Context, fileURL string, offset int64, validator string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	return resp, nil
+}
+
+// complete moves a finished .part file into place and reports it
+func complete(job Job, partPath, filePath string, opts Options) error {
+	if err := finishPart(partPath, filePath); err != nil {
+		return err
+	}
+	if opts.OnComplete != nil {
+		opts.OnComplete(job, filePath)
+	}
+	return nil
+}
+
+// finishPart moves a completed .part file to its final name
+func finishPart(partPath, filePath string) error {
+	if err := os.Rename(partPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %v", err)
+	}
+	os.Remove(partPath + metaSuffix)
 	return nil
 }
@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnCompleteAfterSlot(t *testing.T) {
+	// With two slots, the last download can only start once one of the
+	// others has freed its slot
+	started := make(chan struct{})
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if !requested[r.URL.Path] {
+			requested[r.URL.Path] = true
+			if len(requested) == 3 {
+				close(started)
+			}
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	var finished []string
+	opts := Options{
+		ConcurrentDownloads: 2,
+		OnComplete: func(job Job, filePath string) {
+			// A slow OnComplete, such as hashing for the history, must not
+			// hold up the queue
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Errorf("%s: OnComplete held its slot", job.URL)
+			}
+			mu.Lock()
+			finished = append(finished, filepath.Base(filePath))
+			mu.Unlock()
+		},
+	}
+	jobs := []Job{{URL: server.URL + "/a.mp4"}, {URL: server.URL + "/b.mp4"}, {URL: server.URL + "/c.mp4"}}
+	summary, err := Download(context.Background(), jobs, t.TempDir(), opts)
+	if err != nil || len(summary.Failed) > 0 {
+		t.Fatalf("Download: %v, %+v", err, summary)
+	}
+	if len(finished) != len(jobs) {
+		t.Errorf("OnComplete called for %q, want every job", finished)
+	}
+}
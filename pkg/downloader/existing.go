@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExistingPolicy decides what happens when the target file already exists
+type ExistingPolicy string
+
+const (
+	// PolicySkip leaves complete files alone and re-downloads incomplete ones
+	PolicySkip ExistingPolicy = "skip"
+	// PolicyOverwrite always downloads again and replaces the file
+	PolicyOverwrite ExistingPolicy = "overwrite"
+	// PolicyRename downloads again to name_1.mp4, name_2.mp4, ...
+	PolicyRename ExistingPolicy = "rename"
+	// PolicyResume continues an incomplete file in place
+	PolicyResume ExistingPolicy = "resume"
+)
+
+// ErrSkipped is returned for files that were already downloaded
+var ErrSkipped = errors.New("already downloaded")
+
+// ParsePolicy validates a policy name
+func ParsePolicy(name string) (ExistingPolicy, error) {
+	switch p := ExistingPolicy(strings.ToLower(name)); p {
+	case PolicySkip, PolicyOverwrite, PolicyRename, PolicyResume:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q (use skip, overwrite, rename or resume)", name)
+}
+
+// Exists reports whether the file for a job, from any of its mirrors, is
+// already in the download folder. It works offline, so names that only the
+// server knows are not considered. A file whose size is far from the size
+// listed on the page doesn't count.
+func Exists(job Job, downloadFolder string, tmpl *Template) bool {
+	for _, link := range job.links() {
+		filename, err := filenameFromURL(link)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(downloadFolder, localName(job, filename, tmpl))); err == nil {
+			return checkSize(job, info.Size()) == nil
+		}
+	}
+	return false
+}
+
+// uniquePath returns filePath, or name_1.ext, name_2.ext, ... if it is taken
+func uniquePath(filePath string) string {
+	counter := 1
+	originalPath := filePath
+	for {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return filePath
+		}
+		// File exists, create a new name
+		ext := filepath.Ext(originalPath)
+		base := strings.TrimSuffix(originalPath, ext)
+		filePath = fmt.Sprintf("%s_%d%s", base, counter, ext)
+		counter++
+	}
+}
+
+// applyPolicy decides where to download a file whose target may already exist.
+// It returns ErrSkipped if the existing file is complete and should be kept.
+// expected is the size listed on the page, or 0.
+func applyPolicy(ctx context.Context, fileURL, filePath string, remote *remoteInfo, expected int64, policy ExistingPolicy) (string, error) {
+	local, err := os.Stat(filePath)
+	if err != nil {
+		return filePath, nil
+	}
+
+	switch policy {
+	case PolicyOverwrite:
+		return filePath, nil
+	case PolicyRename:
+		return uniquePath(filePath), nil
+	}
+
+	// skip and resume need the remote size to tell whether the file is complete
+	if remote == nil || remote.Size <= 0 {
+		// Only the page's size is left to compare against
+		if sizeMatches(expected, local.Size()) {
+			return "", ErrSkipped
+		}
+		return filePath, nil
+	}
+
+	switch {
+	case local.Size() == remote.Size:
+		return "", ErrSkipped
+	case policy == PolicyResume && local.Size() < remote.Size && remote.AcceptRanges && remote.Validator != "":
+		// Turn the incomplete file back into a .part file and continue it
+		partPath := filePath + partSuffix
+		if err := os.Rename(filePath, partPath); err != nil {
+			return "", fmt.Errorf("failed to resume existing file: %v", err)
+		}
+		if err := savePartMeta(partPath, &partMeta{URL: fileURL, Validator: remote.Validator}); err != nil {
+			return "", fmt.Errorf("failed to save resume data: %v", err)
+		}
+	}
+
+	// Incomplete or different: download again over it
+	return filePath, nil
+}
@@ -0,0 +1,188 @@
+package downloader
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// videoExtensions are kept as-is; anything else gets .mp4 appended
+var videoExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".avi": true, ".webm": true,
+	".m4v": true, ".mov": true, ".ts": true,
+}
+
+// filenameFromURL derives the local filename for a download link
+func filenameFromURL(fileURL string) (string, error) {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse file URL: %v", err)
+	}
+
+	filename := SanitizeFilename(path.Base(parsedURL.Path))
+	if filename == "" {
+		filename = "video.mp4" // fallback filename
+	}
+	return withVideoExtension(filename), nil
+}
+
+// withVideoExtension appends .mp4 to a filename without a video extension
+func withVideoExtension(filename string) string {
+	if !videoExtensions[strings.ToLower(filepath.Ext(filename))] {
+		filename += ".mp4"
+	}
+	return filename
+}
+
+// contentDispositionName returns the sanitized filename from a
+// Content-Disposition header, or "" if there is none
+func contentDispositionName(header string) string {
+	if header == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	if name := SanitizeFilename(params["filename"]); name != "" {
+		return withVideoExtension(name)
+	}
+	return ""
+}
+
+// SanitizeFilename reduces a name to a single safe path component, so it
+// cannot escape the download folder. It returns "" if nothing usable is left.
+func SanitizeFilename(name string) string {
+	// Only keep the last component of anything that looks like a path
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// templateField matches {field} and {field:02} placeholders
+var templateField = regexp.MustCompile(`\{(\w+)(?::(0?\d+))?\}`)
+
+// templateFields are the placeholders a Template may use
+var templateFields = map[string]bool{
+	"series": true, "season": true, "episode": true, "id": true, "title": true, "quality": true,
+	"name": true, "ext": true,
+}
+
+// Template builds output paths such as
+// "{series}/Season {season:02}/{series} - S{season:02}E{episode:02}.{ext}".
+// Slashes in the template create subdirectories.
+type Template struct {
+	pattern string
+}
+
+// ParseTemplate validates a naming template
+func ParseTemplate(pattern string) (*Template, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("empty naming template")
+	}
+	for _, match := range templateField.FindAllStringSubmatch(pattern, -1) {
+		if !templateFields[match[1]] {
+			return nil, fmt.Errorf("unknown template field {%s}", match[1])
+		}
+	}
+	return &Template{pattern: pattern}, nil
+}
+
+// Render fills in the template for a job. remoteName is the filename the
+// server would use and supplies {name} and {ext}.
+func (t *Template) Render(job Job, remoteName string) string {
+	ext := strings.TrimPrefix(filepath.Ext(remoteName), ".")
+	values := map[string]string{
+		"series":  job.Series,
+		"id":      job.EpisodeID,
+		"title":   job.Title,
+		"quality": job.QualityTag,
+		"name":    strings.TrimSuffix(remoteName, filepath.Ext(remoteName)),
+		"ext":     ext,
+	}
+	numbers := map[string]int{
+		"season":  job.Season,
+		"episode": job.Episode,
+	}
+
+	rendered := templateField.ReplaceAllStringFunc(t.pattern, func(field string) string {
+		match := templateField.FindStringSubmatch(field)
+		if n, ok := numbers[match[1]]; ok {
+			width, _ := strconv.Atoi(match[2])
+			return fmt.Sprintf("%0*d", width, n)
+		}
+		// Values must not introduce extra directories
+		return strings.ReplaceAll(values[match[1]], "/", "_")
+	})
+
+	// Sanitize each directory level; ".." and empty levels are dropped
+	var parts []string
+	for _, part := range strings.Split(rendered, "/") {
+		if part = SanitizeFilename(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// SeriesFolder returns the folder that holds every episode of a series: the
+// leading folders of the template, up to the first that depends on the
+// episode. It reports false unless that folder is named after the series.
+func (t *Template) SeriesFolder(series string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	levels := strings.Split(t.pattern, "/")
+	var folder []string
+	named := false
+	for _, level := range levels[:len(levels)-1] {
+		fields := templateField.FindAllStringSubmatch(level, -1)
+		episodic := false
+		for _, match := range fields {
+			if match[1] != "series" {
+				episodic = true
+			}
+		}
+		if episodic {
+			break
+		}
+		named = named || len(fields) > 0
+		folder = append(folder, level)
+	}
+	if !named {
+		return "", false
+	}
+	rendered := (&Template{pattern: strings.Join(folder, "/")}).Render(Job{Series: series}, "")
+	return rendered, rendered != ""
+}
+
+// localName decides the path of a job relative to the download folder.
+// remoteName is the server's filename (from Content-Disposition or the URL).
+func localName(job Job, remoteName string, tmpl *Template) string {
+	if tmpl != nil && job.EpisodeID != "" {
+		if name := tmpl.Render(job, remoteName); name != "" {
+			return name
+		}
+	}
+	return remoteName
+}
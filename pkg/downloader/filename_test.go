@@ -0,0 +1,36 @@
+package downloader
+
+import "testing"
+
+func TestSeriesFolder(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"{series}/Season {season:02}/{series} - S{season:02}E{episode:02}.{ext}", "Example Show", true},
+		{"{series} ({quality})/{id}.{ext}", "", false},
+		{"TV/{series}/Season {season}/{id}.{ext}", "TV/Example Show", true},
+		{"TV/Shows - {series}/{id}.{ext}", "TV/Shows - Example Show", true},
+		// Sorted by season first, so the series has no folder of its own
+		{"Season {season:02}/{series}/{id}.{ext}", "", false},
+		{"Downloads/{series} - {id}.{ext}", "", false},
+		{"{series} - {id}.{ext}", "", false},
+		{"{series}", "", false},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := tmpl.SeriesFolder("Example Show")
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("SeriesFolder(%q) = %q, %v; want %q, %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	var none *Template
+	if _, ok := none.SeriesFolder("Example Show"); ok {
+		t.Error("no template has a series folder")
+	}
+}
@@ -0,0 +1,46 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"tt6d/pkg/hls"
+)
+
+// downloadHLS downloads an HLS stream and concatenates its segments into a
+// single .ts file
+func downloadHLS(ctx context.Context, job Job, link, downloadFolder string, index, totalFiles, attempt int, opts Options) error {
+	fetch := opts.fetch
+	playlist, err := hls.Load(ctx, fetch, link)
+	if err != nil {
+		return err
+	}
+
+	mediaURL := link
+	if playlist.IsMaster() {
+		variant, err := hls.SelectVariant(playlist.Variants, opts.quality(job))
+		if err != nil {
+			return err
+		}
+		mediaURL = variant.URI
+		if playlist, err = hls.Load(ctx, fetch, mediaURL); err != nil {
+			return err
+		}
+		if playlist.IsMaster() {
+			return fmt.Errorf("variant playlist is another master playlist")
+		}
+	}
+
+	run := func(w io.Writer, concurrency, start int, done func(int, int64)) error {
+		return hls.Download(ctx, playlist, w, hls.Options{
+			Concurrency: concurrency,
+			Fetch:       fetch,
+			Start:       start,
+			OnSegment:   done,
+		})
+	}
+	name := streamFilename(link, ".ts")
+	return downloadStream(ctx, job, downloadFolder, name, mediaURL, len(playlist.Segments),
+		index, totalFiles, attempt, opts, run)
+}
@@ -0,0 +1,248 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tt6d/pkg/datafile"
+)
+
+// JournalFile is the name of the job journal kept in the download folder
+const JournalFile = ".tt6d-journal.json"
+
+// journalVersion is bumped when the journal format changes incompatibly
+const journalVersion = 1
+
+// journalInterval is how often the bytes of active jobs are recorded, so a
+// crash leaves the journal close to what is on disk
+const journalInterval = 5 * time.Second
+
+// JobState is the progress of a journaled job
+type JobState string
+
+const (
+	StatePending JobState = "pending"
+	StateActive  JobState = "active"
+	StateDone    JobState = "done"
+	StateFailed  JobState = "failed"
+)
+
+// JournalEntry records one job and how far it got
+type JournalEntry struct {
+	Job     Job       `json:"job"`
+	State   JobState  `json:"state"`
+	Bytes   int64     `json:"bytes"`
+	Path    string    `json:"path,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Journal is a persistent list of download jobs that survives restarts.
+// A nil *Journal is valid and records nothing.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	Version int             `json:"version"`
+	Entries []*JournalEntry `json:"entries"`
+}
+
+// OpenJournal loads the journal from a download folder, or starts an empty one
+func OpenJournal(downloadFolder string) (*Journal, error) {
+	return readJournal(filepath.Join(downloadFolder, JournalFile))
+}
+
+// readJournal reads a journal file, or returns an empty journal if there is none
+func readJournal(path string) (*Journal, error) {
+	j := &Journal{path: path, Version: journalVersion}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %v", path, err)
+	}
+	if j.Version != journalVersion {
+		return nil, fmt.Errorf("unsupported journal version %d in %s", j.Version, path)
+	}
+	return j, nil
+}
+
+// Add queues jobs as pending. Jobs already in the journal are queued again.
+func (j *Journal) Add(jobs []Job) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range jobs {
+		entry := j.find(job.URL)
+		if entry == nil {
+			entry = &JournalEntry{}
+			j.Entries = append(j.Entries, entry)
+		}
+		*entry = JournalEntry{Job: job, State: StatePending, Updated: time.Now()}
+	}
+	return j.save()
+}
+
+// Unfinished returns the jobs that are not done, in the order they were added.
+// Jobs left active by a crash are included.
+func (j *Journal) Unfinished() []Job {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var jobs []Job
+	for _, entry := range j.Entries {
+		if entry.State != StateDone {
+			jobs = append(jobs, entry.Job)
+		}
+	}
+	return jobs
+}
+
+// start marks a job as active and remembers where it is being written
+func (j *Journal) start(link, filePath string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry := j.find(link); entry != nil {
+		entry.State = StateActive
+		entry.Path = filePath
+		entry.Error = ""
+		entry.Updated = time.Now()
+		j.save()
+	}
+}
+
+// finish records the result of a job. Cancelled jobs go back to pending.
+func (j *Journal) finish(link string, err error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.find(link)
+	if entry == nil {
+		return
+	}
+
+	switch {
+	case err == nil || err == ErrSkipped:
+		entry.State = StateDone
+	case isCancelled(err):
+		entry.State = StatePending
+	default:
+		entry.State = StateFailed
+		entry.Error = err.Error()
+	}
+
+	entry.Bytes = entry.onDisk()
+	entry.Updated = time.Now()
+	j.save()
+}
+
+// track records the bytes of every active job each journalInterval until
+// the returned function is called
+func (j *Journal) track() (stop func()) {
+	if j == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(journalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				j.recordBytes()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// recordBytes saves how much of each active job is on disk, if it changed
+func (j *Journal) recordBytes() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	changed := false
+	for _, entry := range j.Entries {
+		if entry.State != StateActive {
+			continue
+		}
+		if bytes := entry.onDisk(); bytes != entry.Bytes {
+			entry.Bytes = bytes
+			entry.Updated = time.Now()
+			changed = true
+		}
+	}
+	if changed {
+		j.save()
+	}
+}
+
+// onDisk returns the size of the job's file, finished or not
+func (entry *JournalEntry) onDisk() int64 {
+	if entry.Path == "" {
+		return 0
+	}
+	for _, p := range []string{entry.Path, entry.Path + partSuffix} {
+		if info, err := os.Stat(p); err == nil {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+func (j *Journal) find(link string) *JournalEntry {
+	for _, entry := range j.Entries {
+		if entry.Job.URL == link {
+			return entry
+		}
+	}
+	return nil
+}
+
+// save writes the journal atomically so a crash never leaves it half written.
+// It holds the journal's lock and keeps jobs another tt6d has added to the
+// same folder since the journal was read.
+func (j *Journal) save() error {
+	unlock, err := datafile.Lock(j.path)
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	defer unlock()
+
+	if current, err := readJournal(j.path); err == nil {
+		for _, entry := range current.Entries {
+			if j.find(entry.Job.URL) == nil {
+				j.Entries = append(j.Entries, entry)
+			}
+		}
+	}
+	if err := datafile.WriteJSON(j.path, j); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalBytes(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []Job{{URL: "https://example.com/a.mp4"}, {URL: "https://example.com/b.mp4"}}
+	if err := j.Add(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(dir, "a.mp4")
+	j.start(jobs[0].URL, filePath)
+	if err := os.WriteFile(filePath+partSuffix, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bytes of an active job are recorded while it runs
+	j.recordBytes()
+	if got := readEntry(t, dir, jobs[0].URL); got.State != StateActive || got.Bytes != 1000 {
+		t.Errorf("while active: %s with %d bytes, want active with 1000", got.State, got.Bytes)
+	}
+
+	// and when it is cancelled, for the .part file kept for resume
+	if err := os.WriteFile(filePath+partSuffix, make([]byte, 1500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j.finish(jobs[0].URL, errors.Join(errors.New("segment 3"), context.Canceled))
+	if got := readEntry(t, dir, jobs[0].URL); got.State != StatePending || got.Bytes != 1500 {
+		t.Errorf("after cancelling: %s with %d bytes, want pending with 1500", got.State, got.Bytes)
+	}
+	if got := readEntry(t, dir, jobs[1].URL); got.State != StatePending || got.Bytes != 0 {
+		t.Errorf("job not started: %s with %d bytes", got.State, got.Bytes)
+	}
+}
+
+func TestJournalKeepsOtherJobs(t *testing.T) {
+	dir := t.TempDir()
+	first, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two tt6d processes queue jobs in the same folder
+	if err := first.Add([]Job{{URL: "https://example.com/a.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Add([]Job{{URL: "https://example.com/b.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	first.finish("https://example.com/a.mp4", nil)
+
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Entries) != 2 {
+		t.Fatalf("journal has %d jobs, want both", len(j.Entries))
+	}
+	if got := readEntry(t, dir, "https://example.com/a.mp4"); got.State != StateDone {
+		t.Errorf("first job is %s, want done", got.State)
+	}
+	if got := readEntry(t, dir, "https://example.com/b.mp4"); got.State != StatePending {
+		t.Errorf("second job is %s, want pending", got.State)
+	}
+	if _, err := os.Stat(filepath.Join(dir, JournalFile+".lock")); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+// readEntry reads a job's entry back from the journal file
+func readEntry(t *testing.T, dir, link string) JournalEntry {
+	t.Helper()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := j.find(link)
+	if entry == nil {
+		t.Fatalf("%s is not in the journal", link)
+	}
+	return *entry
+}
@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// remoteInfo describes a remote file as reported by a HEAD or GET request
+type remoteInfo struct {
+	Size         int64 // -1 if unknown
+	AcceptRanges bool
+	Validator    string
+	Filename     string // from Content-Disposition or the final URL after redirects
+	Named        bool   // Filename came from Content-Disposition
+	ContentType  string
+}
+
+// errNotVideo is returned when a link leads to a web page, such as a file
+// host's landing page or an error page, instead of the file itself
+var errNotVideo = errors.New("server sent a web page instead of a video")
+
+// errSizeMismatch is returned when a file is far from the size listed on
+// the page, which usually means a mirror serves the wrong file
+var errSizeMismatch = errors.New("file size doesn't match the page")
+
+// sizeTolerance is how far a file may be from the listed size. Pages round
+// sizes and mix up decimal and binary units.
+const sizeTolerance = 0.1
+
+// sizeMatches reports whether size is close to the expected size. An
+// unknown size (0 or less) matches anything.
+func sizeMatches(expected, size int64) bool {
+	if expected <= 0 || size <= 0 {
+		return true
+	}
+	diff := float64(size - expected)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= float64(expected)*sizeTolerance
+}
+
+// checkSize compares a file size with the size listed for the job
+func checkSize(job Job, size int64) error {
+	if sizeMatches(job.Size, size) {
+		return nil
+	}
+	return fmt.Errorf("%w: %d bytes, expected about %d", errSizeMismatch, size, job.Size)
+}
+
+// isWebPage reports whether a Content-Type is HTML
+func isWebPage(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// probe issues a HEAD request to learn the size and range support of a file
+func probe(ctx context.Context, fileURL string) (*remoteInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+	return remoteFromResponse(resp, fileURL), nil
+}
+
+// probeGet asks for the first byte of a file with a GET, for hosts that
+// reject HEAD or only name the file in GET responses. A server that ignores
+// the range sends the whole file; that response is returned with its body
+// open so the download can use it. A 206 is read and closed here.
+func probeGet(ctx context.Context, fileURL string) (*remoteInfo, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return remoteFromResponse(resp, fileURL), resp, nil
+	case http.StatusPartialContent:
+		resp.Body.Close()
+		return remoteFromResponse(resp, fileURL), nil, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// An empty file has no first byte; the download finds out the rest
+		resp.Body.Close()
+		return nil, nil, nil
+	}
+	resp.Body.Close()
+	return nil, nil, newStatusError(resp)
+}
+
+// remoteFromResponse reads what a 200 response, or a 206 for a range, says
+// about a file
+func remoteFromResponse(resp *http.Response, fileURL string) *remoteInfo {
+	info := &remoteInfo{
+		Size:         resp.ContentLength,
+		AcceptRanges: strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "bytes"),
+		Validator:    validatorFromResponse(resp),
+		ContentType:  resp.Header.Get("Content-Type"),
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		// The size of the file is in Content-Range, not in the length
+		info.AcceptRanges = true
+		_, info.Size, _ = parseContentRange(resp.Header.Get("Content-Range"))
+	}
+	info.Filename = contentDispositionName(resp.Header.Get("Content-Disposition"))
+	info.Named = info.Filename != ""
+	if !info.Named && resp.Request != nil && resp.Request.URL.String() != fileURL {
+		info.Filename, _ = filenameFromURL(resp.Request.URL.String())
+	}
+	return info
+}
@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// partSuffix is appended to the final filename while a download is in progress
+const partSuffix = ".part"
+
+// metaSuffix is appended to the .part filename for the resume metadata sidecar
+const metaSuffix = ".meta"
+
+// errNotSegmentable means a file cannot be fetched over multiple connections
+var errNotSegmentable = errors.New("server does not support segmented downloads")
+
+// partMeta holds what we need to safely continue a partial download
+type partMeta struct {
+	URL       string     `json:"url"`
+	Validator string     `json:"validator"` // ETag or Last-Modified, sent as If-Range
+	Size      int64      `json:"size,omitempty"`
+	Segments  []*segment `json:"segments,omitempty"` // set for segmented downloads only
+
+	// HLS downloads record the next segment to fetch and the bytes written before it
+	NextSegment int   `json:"next_segment,omitempty"`
+	Written     int64 `json:"written,omitempty"`
+}
+
+// loadPartMeta reads the sidecar for a .part file, returning nil if it is missing or unreadable
+func loadPartMeta(partPath string) *partMeta {
+	data, err := os.ReadFile(partPath + metaSuffix)
+	if err != nil {
+		return nil
+	}
+
+	var meta partMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// savePartMeta writes the sidecar for a .part file
+func savePartMeta(partPath string, meta *partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partPath+metaSuffix, data, 0644)
+}
+
+// removePart deletes a .part file together with its sidecar
+func removePart(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + metaSuffix)
+}
+
+// validatorFromResponse returns the value to use in If-Range for later resumes.
+// Weak ETags are not allowed in If-Range, so Last-Modified is used instead.
+func validatorFromResponse(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange parses a "bytes start-end/total" or "bytes */total" header.
+// Unknown values are returned as -1.
+func parseContentRange(header string) (start, total int64, err error) {
+	start, total = -1, -1
+
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return start, total, fmt.Errorf("invalid Content-Range: %q", header)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return start, total, fmt.Errorf("invalid Content-Range: %q", header)
+	}
+
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return -1, -1, fmt.Errorf("invalid Content-Range total: %q", header)
+		}
+	}
+
+	if rangePart != "*" {
+		startPart, _, _ := strings.Cut(rangePart, "-")
+		if start, err = strconv.ParseInt(startPart, 10, 64); err != nil {
+			return -1, -1, fmt.Errorf("invalid Content-Range start: %q", header)
+		}
+	}
+
+	return start, total, nil
+}
@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		start   int64
+		total   int64
+		wantErr bool
+	}{
+		// Ranges are inclusive: 0-499 is the first 500 bytes
+		{"bytes 0-499/1234", 0, 1234, false},
+		{"bytes 500-1233/1234", 500, 1234, false},
+		{"bytes 1233-1233/1234", 1233, 1234, false},
+		{" bytes 42-99/* ", 42, -1, false},
+		// Sent with 416 when the range starts past the end
+		{"bytes */1234", -1, 1234, false},
+		{"bytes */*", -1, -1, false},
+
+		{"", -1, -1, true},
+		{"0-499/1234", -1, -1, true},
+		{"items 0-4/10", -1, -1, true},
+		{"bytes 0-499", -1, -1, true},
+		{"bytes 0-499/lots", -1, -1, true},
+		{"bytes x-499/1234", -1, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, total, err := parseContentRange(tt.header)
+			if (err != nil) != tt.wantErr || start != tt.start || total != tt.total {
+				t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d (error %v)",
+					tt.header, start, total, err, tt.start, tt.total, tt.wantErr)
+			}
+		})
+	}
+}
+
+// rangeServer serves content with an ETag and ranges, recording the Range
+// and If-Range headers of every GET
+type rangeServer struct {
+	*httptest.Server
+	content []byte
+	etag    string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRangeServer(t *testing.T, content []byte, etag string) *rangeServer {
+	s := &rangeServer{content: content, etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.mu.Lock()
+			s.requests = append(s.requests, r.Header.Get("Range")+" if "+r.Header.Get("If-Range"))
+			s.mu.Unlock()
+		}
+		w.Header().Set("ETag", s.etag)
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.content))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// lastRequest returns the Range and If-Range of the last GET
+func (s *rangeServer) lastRequest() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return ""
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func TestResumePart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	const have = 20000
+
+	tests := []struct {
+		name string
+		// part is what the .part file holds, meta its sidecar (nil for none)
+		part []byte
+		meta *partMeta
+		// request is the Range and If-Range of the download
+		request string
+	}{
+		{
+			name:    "continued",
+			part:    content[:have],
+			meta:    &partMeta{Validator: `"v2"`},
+			request: `bytes=20000- if "v2"`,
+		},
+		{
+			// The server sends the whole file again, which replaces the part
+			name:    "changed on the server",
+			part:    bytes.Repeat([]byte("x"), have),
+			meta:    &partMeta{Validator: `"v1"`},
+			request: `bytes=20000- if "v1"`,
+		},
+		{
+			// Without a validator the part cannot be checked, so it is
+			// downloaded again
+			name:    "no validator",
+			part:    bytes.Repeat([]byte("x"), have),
+			meta:    &partMeta{},
+			request: " if ",
+		},
+		{
+			name:    "no sidecar",
+			part:    bytes.Repeat([]byte("x"), have),
+			request: " if ",
+		},
+		{
+			// The server answers 416 with bytes */total
+			name:    "already complete",
+			part:    content,
+			meta:    &partMeta{Validator: `"v2"`},
+			request: `bytes=65536- if "v2"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRangeServer(t, content, `"v2"`)
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "episode.mp4")
+			partPath := filePath + partSuffix
+			if err := os.WriteFile(partPath, tt.part, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.meta != nil {
+				tt.meta.URL = server.URL + "/episode.mp4"
+				if err := savePartMeta(partPath, tt.meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			job := Job{URL: server.URL + "/episode.mp4"}
+			summary, err := Download(context.Background(), []Job{job}, dir, Options{})
+			if err != nil || len(summary.Failed) > 0 {
+				t.Fatalf("Download: %v, %+v", err, summary)
+			}
+			if got := server.lastRequest(); got != tt.request {
+				t.Errorf("download asked for %q, want %q", got, tt.request)
+			}
+			got, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("file has %d bytes that differ from the %d served", len(got), len(content))
+			}
+			for _, leftover := range []string{partPath, partPath + metaSuffix} {
+				if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+					t.Errorf("%s is left behind", filepath.Base(leftover))
+				}
+			}
+		})
+	}
+}
+
+func TestValidatorFromResponse(t *testing.T) {
+	tests := []struct {
+		etag, lastModified string
+		want               string
+	}{
+		{`"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT", `"abc"`},
+		// Weak ETags are not allowed in If-Range
+		{`W/"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT", "Mon, 02 Jan 2006 15:04:05 GMT"},
+		{"", "Mon, 02 Jan 2006 15:04:05 GMT", "Mon, 02 Jan 2006 15:04:05 GMT"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.etag != "" {
+			resp.Header.Set("ETag", tt.etag)
+		}
+		if tt.lastModified != "" {
+			resp.Header.Set("Last-Modified", tt.lastModified)
+		}
+		if got := validatorFromResponse(resp); got != tt.want {
+			t.Errorf("validatorFromResponse(%q, %q) = %q, want %q", tt.etag, tt.lastModified, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed downloads are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries per file, including the first
+	MaxAttempts int
+	// BaseDelay is the wait before the second attempt; it doubles on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay
+	MaxDelay time.Duration
+	// StallTimeout aborts an attempt when no data arrives for this long
+	StallTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  5,
+		BaseDelay:    2 * time.Second,
+		MaxDelay:     time.Minute,
+		StallTimeout: 30 * time.Second,
+	}
+}
+
+// errStalled is returned when a response body stops delivering data
+var errStalled = errors.New("download stalled")
+
+// errIncomplete is returned when the server closed the body before all bytes arrived
+var errIncomplete = errors.New("download incomplete")
+
+// statusError is an unexpected HTTP status code
+type statusError struct {
+	Code       int
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return "server returned status code: " + strconv.Itoa(e.Code)
+}
+
+// newStatusError builds a statusError, reading Retry-After if present
+func newStatusError(resp *http.Response) *statusError {
+	return &statusError{
+		Code:       resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// isTransient reports whether err is worth retrying.
+// Dropped connections, timeouts, stalls, 5xx, 408 and 429 are transient;
+// anything else, including 404 and 410, unknown hosts, bad certificates
+// and unsupported URLs, is permanent.
+func isTransient(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 ||
+			statusErr.Code == http.StatusTooManyRequests ||
+			statusErr.Code == http.StatusRequestTimeout
+	}
+
+	if errors.Is(err, errStalled) || errors.Is(err, errIncomplete) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// A lookup that found no such host won't find one on the next try
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || (dnsErr.IsTemporary && !dnsErr.IsNotFound)
+	}
+	if isCertificateError(err) {
+		return false
+	}
+
+	// *url.Error is a net.Error too, so only real timeouts count
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isCertificateError reports whether err is a TLS certificate problem
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// backoff returns how long to wait before the given retry (1 = first retry).
+// Half of the delay is randomized so parallel workers do not retry in lockstep.
+func (p RetryPolicy) backoff(retry int, err error) time.Duration {
+	// Without a cap, doubling stops before it overflows
+	limit := p.MaxDelay
+	if limit <= 0 {
+		limit = math.MaxInt64 / 2
+	}
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < limit; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	// The server knows best when it is rate limiting us
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	return delay
+}
+
+// stallReader wraps a response body and cancels the request if no data
+// arrives within the timeout
+type stallReader struct {
+	body    io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	mu      sync.Mutex
+	stalled bool
+}
+
+// newStallRequest returns a context for a request whose body is guarded by a
+// stallReader, and a function that wraps the response body
+func newStallRequest(parent context.Context, timeout time.Duration) (context.Context, func(io.Reader) io.Reader, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	if timeout <= 0 {
+		return ctx, func(r io.Reader) io.Reader { return r }, cancel
+	}
+
+	sr := &stallReader{timeout: timeout}
+	sr.timer = time.AfterFunc(timeout, func() {
+		sr.mu.Lock()
+		sr.stalled = true
+		sr.mu.Unlock()
+		cancel()
+	})
+
+	wrap := func(r io.Reader) io.Reader {
+		sr.body = r
+		return sr
+	}
+	stop := func() {
+		sr.timer.Stop()
+		cancel()
+	}
+	return ctx, wrap, stop
+}
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	n, err := sr.body.Read(p)
+	if n > 0 {
+		sr.timer.Reset(sr.timeout)
+	}
+	if err != nil && err != io.EOF {
+		sr.mu.Lock()
+		stalled := sr.stalled
+		sr.mu.Unlock()
+		if stalled {
+			return n, errStalled
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,156 @@
+package downloader
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/a.mp4", Err: err}
+	}
+	dial := func(err error) error {
+		return urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"500", &statusError{Code: 500}, true},
+		{"502", &statusError{Code: 502}, true},
+		{"503 wrapped", fmt.Errorf("segment 4: %w", &statusError{Code: 503}), true},
+		{"408", &statusError{Code: http.StatusRequestTimeout}, true},
+		{"429", &statusError{Code: http.StatusTooManyRequests}, true},
+		{"403", &statusError{Code: 403}, false},
+		{"404", &statusError{Code: 404}, false},
+		{"410", &statusError{Code: 410}, false},
+		{"416", &statusError{Code: 416}, false},
+
+		{"stalled", fmt.Errorf("failed to write file: %w", errStalled), true},
+		{"incomplete", errIncomplete, true},
+		{"EOF", urlErr(io.EOF), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"connection reset", urlErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"connection refused", dial(syscall.ECONNREFUSED), true},
+		{"connection timed out", dial(syscall.ETIMEDOUT), true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"timeout", urlErr(timeoutError{}), true},
+		{"deadline", urlErr(context.DeadlineExceeded), true},
+
+		{"no such host", urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}), false},
+		{"DNS timeout", urlErr(&net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}), true},
+		{"DNS server failure", &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, true},
+		{"unknown authority", urlErr(x509.UnknownAuthorityError{}), false},
+		{"wrong host", urlErr(x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}), false},
+		{"unsupported scheme", urlErr(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"cancelled", urlErr(context.Canceled), false},
+		{"web page", errNotVideo, false},
+		{"wrong size", fmt.Errorf("%w: 10 bytes, expected about 100", errSizeMismatch), false},
+		{"other", errors.New("failed to create file: permission denied"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+	tests := []struct {
+		policy RetryPolicy
+		retry  int
+		delay  time.Duration // before jitter; the wait is between half and all of it
+	}{
+		{policy, 1, 2 * time.Second},
+		{policy, 2, 4 * time.Second},
+		{policy, 3, 8 * time.Second},
+		{policy, 5, 32 * time.Second},
+		{policy, 6, time.Minute},
+		{policy, 60, time.Minute},
+		// No cap
+		{RetryPolicy{BaseDelay: time.Second}, 11, 1024 * time.Second},
+		{RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: 5 * time.Second}, 1, 5 * time.Second},
+		{RetryPolicy{}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v/%d", tt.policy.BaseDelay, tt.retry), func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 200; i++ {
+				got := tt.policy.backoff(tt.retry, errIncomplete)
+				if got < tt.delay/2 || got > tt.delay {
+					t.Fatalf("backoff = %v, want between %v and %v", got, tt.delay/2, tt.delay)
+				}
+				seen[got] = true
+			}
+			// Jitter spreads the waits of parallel workers
+			if tt.delay > 0 && len(seen) < 100 {
+				t.Errorf("only %d different delays in 200 tries", len(seen))
+			}
+		})
+	}
+
+	// Without a cap, many retries don't overflow
+	if got := (RetryPolicy{BaseDelay: time.Second}).backoff(200, errIncomplete); got < time.Duration(math.MaxInt64/8) {
+		t.Errorf("backoff after 200 retries = %v", got)
+	}
+}
+
+func TestBackoffRetryAfter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+
+	// A longer Retry-After wins, even over the cap
+	err := fmt.Errorf("segment 2: %w", &statusError{Code: 429, RetryAfter: 90 * time.Second})
+	if got := policy.backoff(1, err); got != 90*time.Second {
+		t.Errorf("backoff with Retry-After 90s = %v", got)
+	}
+
+	// A shorter one does not cut the backoff
+	err = &statusError{Code: 503, RetryAfter: time.Second}
+	if got := policy.backoff(3, err); got < 4*time.Second || got > 8*time.Second {
+		t.Errorf("backoff with Retry-After 1s = %v, want between 4s and 8s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"tt6d/pkg/progress"
+)
+
+// minSegmentSize is the smallest byte range worth its own connection
+const minSegmentSize = 1 << 20
+
+// segment is an inclusive byte range of a file and how much of it is on disk
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (s *segment) remaining() int64 {
+	return s.End - s.Start + 1 - s.Done
+}
+
+// splitSegments divides size bytes into at most n ranges of at least minSegmentSize
+func splitSegments(size int64, n int) []*segment {
+	if max := int(size / minSegmentSize); n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	chunk := size / int64(n)
+	segments := make([]*segment, n)
+	for i := range segments {
+		start := int64(i) * chunk
+		end := start + chunk - 1
+		if i == n-1 {
+			end = size - 1
+		}
+		segments[i] = &segment{Start: start, End: end}
+	}
+	return segments
+}
+
+// downloadSegmented fetches a file over several parallel range requests into a
+// preallocated .part file. It returns errNotSegmentable if the server does not
+// support ranges, so the caller can fall back to a single connection.
+func downloadSegmented(ctx context.Context, fileURL, partPath, filename string, info *remoteInfo, index, totalFiles, attempt int, opts Options) error {
+	if info == nil || !info.AcceptRanges || info.Size <= 0 || info.Validator == "" {
+		return errNotSegmentable
+	}
+
+	// Reuse segment progress from an earlier run if the file is unchanged
+	meta := loadPartMeta(partPath)
+	unchanged := meta != nil && meta.Validator == info.Validator
+	switch {
+	case unchanged && len(meta.Segments) > 0 && meta.Size == info.Size:
+	case unchanged && len(meta.Segments) == 0 && partSize(partPath) > 0 && partSize(partPath) < info.Size:
+		// A .part file from a single connection: keep what is on disk as a
+		// finished first segment and split the rest
+		done := partSize(partPath)
+		rest := splitSegments(info.Size-done, opts.Connections)
+		if len(rest) < 2 {
+			// Not worth splitting; the caller continues it as one stream
+			return errNotSegmentable
+		}
+		segments := []*segment{{Start: 0, End: done - 1, Done: done}}
+		for _, seg := range rest {
+			segments = append(segments, &segment{Start: seg.Start + done, End: seg.End + done})
+		}
+		meta = &partMeta{URL: fileURL, Validator: info.Validator, Size: info.Size, Segments: segments}
+	default:
+		segments := splitSegments(info.Size, opts.Connections)
+		if len(segments) < 2 {
+			return errNotSegmentable
+		}
+		removePart(partPath)
+		meta = &partMeta{URL: fileURL, Validator: info.Validator, Size: info.Size, Segments: segments}
+	}
+
+	out, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer out.Close()
+
+	// Preallocate so every segment can write at its own offset
+	if err := out.Truncate(info.Size); err != nil {
+		return fmt.Errorf("failed to preallocate file: %v", err)
+	}
+	if err := savePartMeta(partPath, meta); err != nil {
+		return fmt.Errorf("failed to save resume data: %v", err)
+	}
+
+	// All segments report into one progress bar
+	progressWriter := progress.New(io.Discard, info.Size, filename, index, totalFiles)
+	var done int64
+	for _, seg := range meta.Segments {
+		done += seg.Done
+	}
+	progressWriter.SetOffset(done)
+	progressWriter.SetAttempt(attempt, opts.Retry.MaxAttempts)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(meta.Segments))
+	for i, seg := range meta.Segments {
+		if seg.remaining() <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, seg *segment) {
+			defer wg.Done()
+			errs[i] = fetchSegment(ctx, fileURL, meta.Validator, seg, out, progressWriter, opts)
+		}(i, seg)
+	}
+	wg.Wait()
+
+	// Record progress so a failed run can pick up where each segment stopped
+	if err := savePartMeta(partPath, meta); err != nil {
+		return fmt.Errorf("failed to save resume data: %v", err)
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", i+1, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	progressWriter.Done()
+	return nil
+}
+
+// fetchSegment downloads the remaining bytes of seg into out
+func fetchSegment(ctx context.Context, fileURL, validator string, seg *segment, out *os.File, progressWriter io.Writer, opts Options) error {
+	offset := seg.Start + seg.Done
+
+	reqCtx, wrapBody, stop := newStallRequest(ctx, opts.Retry.StallTimeout)
+	defer stop()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, seg.End))
+	req.Header.Set("If-Range", validator)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download segment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("file changed on server")
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return newStatusError(resp)
+	}
+	if start, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != offset {
+		return fmt.Errorf("server returned wrong range: %q", resp.Header.Get("Content-Range"))
+	}
+
+	tracker := &segmentWriter{seg: seg}
+	writer := io.MultiWriter(io.NewOffsetWriter(out, offset), tracker, progressWriter)
+	if _, err := io.CopyN(writer, opts.Limiter.Reader(ctx, wrapBody(resp.Body)), seg.remaining()); err != nil {
+		if err == io.EOF {
+			err = errIncomplete
+		}
+		return fmt.Errorf("failed to save segment: %w", err)
+	}
+	return nil
+}
+
+// partSize returns the size of a .part file, or 0 if there is none
+func partSize(partPath string) int64 {
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// segmentWriter counts bytes written to a segment
+type segmentWriter struct {
+	seg *segment
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+	sw.seg.Done += int64(len(p))
+	return len(p), nil
+}
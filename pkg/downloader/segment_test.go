@@ -0,0 +1,140 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitSegments(t *testing.T) {
+	const mb = minSegmentSize
+	tests := []struct {
+		name string
+		size int64
+		n    int
+		want []segment
+	}{
+		{"even", 4 * mb, 4, []segment{{Start: 0, End: mb - 1}, {Start: mb, End: 2*mb - 1}, {Start: 2 * mb, End: 3*mb - 1}, {Start: 3 * mb, End: 4*mb - 1}}},
+		// The last range takes what doesn't divide evenly
+		{"uneven", 3*mb + 5, 3, []segment{{Start: 0, End: mb}, {Start: mb + 1, End: 2*mb + 1}, {Start: 2*mb + 2, End: 3*mb + 4}}},
+		// Ranges are kept to at least minSegmentSize
+		{"fewer than asked", 3*mb - 1, 4, []segment{{Start: 0, End: 1572862}, {Start: 1572863, End: 3*mb - 2}}},
+		{"too small to split", 10, 4, []segment{{Start: 0, End: 9}}},
+		{"one connection", 8 * mb, 1, []segment{{Start: 0, End: 8*mb - 1}}},
+		{"no connections", 8 * mb, 0, []segment{{Start: 0, End: 8*mb - 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []segment
+			var covered int64
+			for _, seg := range splitSegments(tt.size, tt.n) {
+				got = append(got, *seg)
+				covered += seg.remaining()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSegments(%d, %d) =\n%+v\nwant\n%+v", tt.size, tt.n, got, tt.want)
+			}
+			// Inclusive ranges cover every byte once
+			if covered != tt.size {
+				t.Errorf("segments cover %d bytes, want %d", covered, tt.size)
+			}
+		})
+	}
+}
+
+func TestSegmentRemaining(t *testing.T) {
+	tests := []struct {
+		seg  segment
+		want int64
+	}{
+		{segment{Start: 0, End: 0}, 1},
+		{segment{Start: 100, End: 199}, 100},
+		{segment{Start: 100, End: 199, Done: 40}, 60},
+		{segment{Start: 100, End: 199, Done: 100}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.seg.remaining(); got != tt.want {
+			t.Errorf("%+v has %d bytes left, want %d", tt.seg, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSegmented(t *testing.T) {
+	content := make([]byte, 3*minSegmentSize+5)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	link := "/episode.mp4"
+
+	tests := []struct {
+		name string
+		// done is how much of each range is on disk from an earlier run;
+		// nil starts afresh
+		done     []int64
+		requests []string
+	}{
+		{
+			name:     "fresh",
+			requests: []string{`bytes=0-1048576 if "v1"`, `bytes=1048577-2097153 if "v1"`, `bytes=2097154-3145732 if "v1"`},
+		},
+		{
+			// Only what is left of each range is asked for, and a range
+			// that is complete is not asked for at all
+			name:     "continued",
+			done:     []int64{1048577, 100, 5000},
+			requests: []string{`bytes=1048677-2097153 if "v1"`, `bytes=2102154-3145732 if "v1"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRangeServer(t, content, `"v1"`)
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "episode.mp4")
+			partPath := filePath + partSuffix
+
+			if tt.done != nil {
+				part := make([]byte, len(content))
+				segments := splitSegments(int64(len(content)), 3)
+				for i, seg := range segments {
+					seg.Done = tt.done[i]
+					copy(part[seg.Start:], content[seg.Start:seg.Start+seg.Done])
+				}
+				if err := os.WriteFile(partPath, part, 0644); err != nil {
+					t.Fatal(err)
+				}
+				meta := &partMeta{URL: server.URL + link, Validator: `"v1"`, Size: int64(len(content)), Segments: segments}
+				if err := savePartMeta(partPath, meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			summary, err := Download(context.Background(), []Job{{URL: server.URL + link}}, dir, Options{Connections: 3})
+			if err != nil || len(summary.Failed) > 0 {
+				t.Fatalf("Download: %v, %+v", err, summary)
+			}
+
+			var requests []string
+			for _, r := range server.requests {
+				// The filename probe asks for the first byte
+				if r != "bytes=0-0 if " {
+					requests = append(requests, r)
+				}
+			}
+			sort.Strings(requests)
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("ranges asked for:\n%q\nwant\n%q", requests, tt.requests)
+			}
+			got, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("file has %d bytes that differ from the %d served", len(got), len(content))
+			}
+		})
+	}
+}
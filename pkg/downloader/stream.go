@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"tt6d/pkg/progress"
+)
+
+// streamConcurrency is the default number of segments fetched at once
+const streamConcurrency = 4
+
+// fetch opens a URL with the same stall detection, rate limiting and error
+// classification as regular downloads
+func (opts Options) fetch(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	reqCtx, wrapBody, stop := newStallRequest(ctx, opts.Retry.StallTimeout)
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		stop()
+		return nil, newStatusError(resp)
+	}
+
+	return &fetchedBody{
+		Reader: opts.Limiter.Reader(ctx, wrapBody(resp.Body)),
+		close: func() error {
+			defer stop()
+			return resp.Body.Close()
+		},
+	}, nil
+}
+
+type fetchedBody struct {
+	io.Reader
+	close func() error
+}
+
+func (b *fetchedBody) Close() error {
+	return b.close()
+}
+
+// streamFilename names the file for a stream, e.g. ".../index.m3u8" and
+// ext ".ts" give "index.ts"
+func streamFilename(streamURL, ext string) string {
+	name := "stream"
+	if u, err := url.Parse(streamURL); err == nil {
+		if base := SanitizeFilename(strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))); base != "" {
+			name = base
+		}
+	}
+	return name + ext
+}
+
+// quality returns the stream quality to use for a job
+func (opts Options) quality(job Job) string {
+	if job.Quality != "" {
+		return job.Quality
+	}
+	return opts.Quality
+}
+
+// segmentRunner writes the segments of a stream to w, starting at segment
+// start and calling done after each one
+type segmentRunner func(w io.Writer, concurrency, start int, done func(index int, written int64)) error
+
+// downloadStream saves a segmented stream (HLS or DASH) as name. source
+// identifies the chosen stream so a .part file is only continued with the
+// same one. Progress is kept per segment so retries continue after the
+// last segment written.
+func downloadStream(ctx context.Context, job Job, downloadFolder, name, source string, segments int, index, totalFiles, attempt int, opts Options, run segmentRunner) error {
+	filePath := filepath.Join(downloadFolder, localName(job, name, opts.Template))
+	filePath, err := applyPolicy(ctx, source, filePath, nil, 0, opts.OnExisting)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %v", err)
+	}
+	filename := filepath.Base(filePath)
+	partPath := filePath + partSuffix
+	opts.Journal.start(job.URL, filePath)
+
+	defer func() {
+		if ctx.Err() != nil && opts.DiscardPartial {
+			removePart(partPath)
+		}
+	}()
+
+	// Continue after the last complete segment of an earlier attempt
+	meta := loadPartMeta(partPath)
+	if meta == nil || meta.URL != source || meta.NextSegment > segments {
+		meta = &partMeta{URL: source}
+	}
+
+	out, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer out.Close()
+
+	// Drop anything written after the last recorded segment
+	if err := out.Truncate(meta.Written); err != nil {
+		return fmt.Errorf("failed to truncate partial file: %v", err)
+	}
+	if _, err := out.Seek(meta.Written, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek partial file: %v", err)
+	}
+
+	progressWriter := progress.New(out, 0, filename, index, totalFiles)
+	progressWriter.SetOffset(meta.Written)
+	progressWriter.SetAttempt(attempt, opts.Retry.MaxAttempts)
+	progressWriter.SetSegments(meta.NextSegment, segments)
+
+	concurrency := opts.Connections
+	if concurrency < 2 {
+		concurrency = streamConcurrency
+	}
+
+	err = run(progressWriter, concurrency, meta.NextSegment, func(i int, written int64) {
+		// Record the file position rather than summing segment sizes, so
+		// headers written before the first segment are included
+		pos, err := out.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+		meta.NextSegment = i + 1
+		meta.Written = pos
+		savePartMeta(partPath, meta)
+		progressWriter.SetSegments(i+1, segments)
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+
+	progressWriter.Done()
+	return complete(job, partPath, filePath, opts)
+}
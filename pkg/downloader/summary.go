@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Failure is a download that did not complete
+type Failure struct {
+	URL string
+	Err error
+}
+
+// Summary reports the outcome of a Download call
+type Summary struct {
+	mu        sync.Mutex
+	Completed []string
+	Skipped   []string
+	Failed    []Failure
+	Cancelled []string
+}
+
+// add records the result of one download
+func (s *Summary) add(link string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err == nil:
+		s.Completed = append(s.Completed, link)
+	case err == ErrSkipped:
+		s.Skipped = append(s.Skipped, link)
+	case isCancelled(err):
+		s.Cancelled = append(s.Cancelled, link)
+	default:
+		s.Failed = append(s.Failed, Failure{URL: link, Err: err})
+	}
+}
+
+// Print writes a short report of what finished, failed and was cancelled
+func (s *Summary) Print() {
+	fmt.Printf("Completed: %d, Skipped: %d, Failed: %d, Cancelled: %d\n",
+		len(s.Completed), len(s.Skipped), len(s.Failed), len(s.Cancelled))
+	for _, f := range s.Failed {
+		fmt.Printf("  ✗ %s: %v\n", f.URL, f.Err)
+	}
+	for _, link := range s.Cancelled {
+		fmt.Printf("  - %s (not finished)\n", link)
+	}
+}
+
+// isCancelled reports whether err comes from a cancelled context
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,43 @@
+package extractor
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+)
+
+func init() {
+	Register("todaytvseries", PrioritySite, todayTVSeriesProvider{})
+	Register("generic", PriorityGeneric, genericProvider{})
+}
+
+// todayTVSeriesHost matches todaytvseries.com and its numbered mirrors
+var todayTVSeriesHost = regexp.MustCompile(`(?i)(^|\.)todaytvseries\d*\.com$`)
+
+// todayTVSeriesProvider reads the season and episode tables of todaytvseries
+type todayTVSeriesProvider struct{}
+
+func (todayTVSeriesProvider) Match(pageURL string) bool {
+	u, err := url.Parse(pageURL)
+	return err == nil && todayTVSeriesHost.MatchString(u.Hostname())
+}
+
+func (todayTVSeriesProvider) Extract(ctx context.Context, page *Page) (*TVSeriesInfo, error) {
+	return ExtractTVSeriesInfo(page.Body)
+}
+
+// genericProvider finds video links on any page. It matches every URL and
+// has the lowest priority, so it is the fallback for all other providers.
+type genericProvider struct{}
+
+func (genericProvider) Match(pageURL string) bool {
+	return true
+}
+
+func (genericProvider) Extract(ctx context.Context, page *Page) (*TVSeriesInfo, error) {
+	links, err := extractGenericMP4Links(page.Body, page.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &TVSeriesInfo{Links: links}, nil
+}
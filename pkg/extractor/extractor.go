@@ -1,7 +1,7 @@
 package extractor
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,282 +9,174 @@ import (
 	"os"
 	"regexp"
 	"strings"
-)
-
-// ExtractContent extracts either TV series info or generic MP4 links from a URL
-func ExtractContent(pageURL string) ([]string, *TVSeriesInfo, error) {
-	resp, err := http.Get(pageURL)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch page: %v", err)
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("page returned status code: %d", resp.StatusCode)
-	}
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read response body: %v", err)
-	}
-	bodyString := string(bodyBytes)
+	"golang.org/x/net/html"
+)
 
-	// Check if this is a todaytvseries domain
-	domainCheck := regexp.MustCompile(`todaytvseries\d*\.com`)
-	if !domainCheck.MatchString(pageURL) {
-		links, err := extractGenericMP4Links(bodyString, pageURL)
-		return links, nil, err
-	}
+// Messages receives the progress messages printed while extracting
+var Messages io.Writer = os.Stdout
 
-	// Try to extract TV series info
-	info, err := ExtractTVSeriesInfo(bodyString)
+// ExtractContent extracts either TV series info or generic MP4 links from a
+// URL, using the registered providers
+func ExtractContent(ctx context.Context, pageURL string) ([]string, *TVSeriesInfo, error) {
+	page, err := fetchPage(ctx, pageURL)
 	if err != nil {
-		// Fallback to generic MP4 links
-		links, err := extractGenericMP4Links(bodyString, pageURL)
-		return links, nil, err
+		return nil, nil, err
 	}
-
-	return nil, info, nil
+	return ExtractPage(ctx, page)
 }
 
-// extractTVSeriesLinks extracts links from TodayTVSeries pages
-func extractTVSeriesLinks(bodyString, pageURL string) ([]string, error) {
-	// Extract available seasons
-	seasonsRe := regexp.MustCompile(`Download Season ([0-9]{1,})`)
-	seasonMatches := seasonsRe.FindAllStringSubmatch(bodyString, -1)
-
-	if len(seasonMatches) == 0 {
-		fmt.Println("No seasons found on this page")
-		return extractGenericMP4Links(bodyString, pageURL)
+// ExtractPage reads a page that has already been fetched, such as a saved
+// copy. Links are made absolute against page.URL; with an empty URL every
+// provider is tried and relative links are kept.
+func ExtractPage(ctx context.Context, page *Page) ([]string, *TVSeriesInfo, error) {
+	info, err := extractPage(ctx, page)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Get unique seasons
-	seasonMap := make(map[string]bool)
-	for _, match := range seasonMatches {
-		if len(match) > 1 {
-			seasonMap[match[1]] = true
+	// Make the poster and download URLs absolute
+	if base, err := url.Parse(page.URL); err == nil && page.URL != "" {
+		info.Poster = absolute(base, info.Poster)
+		for i, link := range info.Links {
+			info.Links[i] = absolute(base, link)
+		}
+		for _, episodes := range info.Seasons {
+			for i := range episodes {
+				for j, link := range episodes[i].Links {
+					episodes[i].Links[j] = absolute(base, link)
+				}
+			}
 		}
 	}
 
-	var seasons []string
-	for season := range seasonMap {
-		seasons = append(seasons, season)
-	}
-
-	// Extract title
-	titleRe := regexp.MustCompile(`uk-article-title uk-badge1">(.*)</h1>`)
-	titleMatch := titleRe.FindStringSubmatch(bodyString)
-	title := "TV Series"
-	if len(titleMatch) > 1 {
-		title = titleMatch[1]
+	if len(info.Seasons) == 0 {
+		return info.Links, nil, nil
 	}
+	return nil, info, nil
+}
 
-	fmt.Printf("\nAvailable seasons to download in %s:\n", title)
-	for _, season := range seasons {
-		fmt.Printf("%s Season %s\n", title, season)
+// fetchPage downloads a web page
+func fetchPage(ctx context.Context, pageURL string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	// Ask user for season selection
-	fmt.Print("\nEnter the season number that you want to download: ")
-	reader := bufio.NewReader(os.Stdin)
-	userInput, err := reader.ReadString('\n')
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read user input: %v", err)
+		return nil, fmt.Errorf("failed to fetch page: %v", err)
 	}
+	defer resp.Body.Close()
 
-	userInput = strings.TrimSpace(userInput)
-	selectedSeason := fmt.Sprintf("%02s", userInput)
-
-	// Check if selected season exists
-	found := false
-	for _, season := range seasons {
-		if season == userInput || season == selectedSeason ||
-			fmt.Sprintf("%02s", season) == selectedSeason {
-			found = true
-			break
-		}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("page returned status code: %d", resp.StatusCode)
 	}
 
-	if !found {
-		return nil, fmt.Errorf("season %s not available", userInput)
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
 	}
+	return &Page{URL: pageURL, Body: string(bodyBytes)}, nil
+}
 
-	// Find episodes for the selected season
-	episodePattern := fmt.Sprintf(`<div class="cell2">(S%sE[0-9]{1,})`, selectedSeason)
-	episodeRe := regexp.MustCompile(episodePattern)
-	episodeMatches := episodeRe.FindAllStringSubmatch(bodyString, -1)
-
-	if len(episodeMatches) == 0 {
-		return nil, fmt.Errorf("no episodes found for season %s", selectedSeason)
+// absolute resolves link against base, leaving it unchanged if it is
+// empty or cannot be parsed
+func absolute(base *url.URL, link string) string {
+	if link == "" {
+		return link
 	}
-
-	fmt.Printf("\nAvailable episodes in Season %s:\n", selectedSeason)
-	var episodes []string
-	for _, match := range episodeMatches {
-		if len(match) > 1 {
-			episodes = append(episodes, match[1])
-			fmt.Println(match[1])
-		}
+	u, err := base.Parse(link)
+	if err != nil {
+		return link
 	}
+	return u.String()
+}
 
-	// Extract download links for each episode
-	var links []string
-	for _, episode := range episodes {
-		linkPatterns := []string{
-			fmt.Sprintf(`%s</div><div class="cell[0-9]">[0-9]{1,} Mb</div><div class="cell[0-9]"><a href=['"]?([^'" >]+)['"]? class="hvr-icon-sink-away" target="_blank">.*</a></div>`, regexp.QuoteMeta(episode)),
-			fmt.Sprintf(`%s[^<]*</div>[^<]*<div[^>]*>[^<]*[0-9]+\s*Mb[^<]*</div>[^<]*<div[^>]*><a\s+href=['"]([^'"]+)['"]`, regexp.QuoteMeta(episode)),
-			fmt.Sprintf(`%s.*?href=['"]([^'"]+)['"].*?target="_blank"`, regexp.QuoteMeta(episode)),
-			fmt.Sprintf(`%s.*?<a[^>]+href=['"]([^'"]+)['"]`, regexp.QuoteMeta(episode)),
-		}
-
-		found := false
-		for _, pattern := range linkPatterns {
-			re := regexp.MustCompile(pattern)
-			match := re.FindStringSubmatch(bodyString)
-			if len(match) > 1 {
-				links = append(links, match[1])
-				fmt.Printf("Found link for %s: %s\n", episode, match[1])
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			fmt.Printf("Warning: No download link found for episode %s\n", episode)
-		}
-	}
+// quotedStringRe finds quoted strings in scripts, where players are configured
+var quotedStringRe = regexp.MustCompile(`['"]([^'"\s]+)['"]`)
 
-	return links, nil
-}
+// bareURLRe finds URLs written out as text
+var bareURLRe = regexp.MustCompile(`https?://[^\s'"<>]+`)
 
-// extractGenericMP4Links extracts MP4 links from generic web pages
+// extractGenericMP4Links extracts MP4, HLS and DASH links from generic web
+// pages. Every attribute is considered, so links in href, src, data-url,
+// data-video and similar attributes are found wherever they appear, along
+// with URLs in player scripts and page text.
 func extractGenericMP4Links(bodyString, pageURL string) ([]string, error) {
 	baseURL, err := url.Parse(pageURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse base URL: %v", err)
 	}
 
-	var mp4Links []string
-	fmt.Println("\nSearching for MP4 links using generic patterns...")
-
-	// Multiple regex patterns to catch different types of MP4 links
-	patterns := []string{
-		// Direct .mp4 file links
-		`href\s*=\s*['"](https?://[^'"]*\.mp4[^'"]*)['"]`,
-		`href\s*=\s*['"](\.\/[^'"]*\.mp4[^'"]*)['"]`,
-		`href\s*=\s*['"]([^'"]*\.mp4)['"]`,
-		`(https?://[^\s'"<>]+\.mp4[^\s'"<>]*)`,
-
-		// Download buttons and links
-		`<a[^>]+href\s*=\s*['"](https?://[^'"]+)['"]\s*[^>]*target\s*=\s*['"]_blank['"][^>]*>`,
-		`href\s*=\s*['"](https?://[^'"]+\.mp4[^'"]*)['"]\s+class\s*=\s*['"][^'"]*download[^'"]*['"]`,
-
-		// Video source elements
-		`<source[^>]+src\s*=\s*['"](https?://[^'"]*\.mp4[^'"]*)['"]`,
-		`<video[^>]+src\s*=\s*['"](https?://[^'"]*\.mp4[^'"]*)['"]`,
-
-		// Common download sites
-		`href\s*=\s*['"](https?://[^'"]*(?:mediafire|mega|drive\.google|dropbox|onedrive)[^'"]*\.mp4[^'"]*)['"]`,
-
-		// Fallback patterns
-		`['"]([^'"]*\.mp4[^'"]*)['"]`,
-		`(https?://[^\s<>"']+\.mp4)`,
-
-		// Additional patterns for embedded players
-		`data-url\s*=\s*['"](https?://[^'"]*\.mp4[^'"]*)['"]`,
-		`data-video\s*=\s*['"](https?://[^'"]*\.mp4[^'"]*)['"]`,
+	doc, err := parseHTML(bodyString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %v", err)
 	}
 
-	for i, pattern := range patterns {
-		fmt.Printf("Trying pattern %d...\n", i+1)
-		re := regexp.MustCompile(`(?i)` + pattern) // Case insensitive
-		matches := re.FindAllStringSubmatch(bodyString, -1)
-
-		for _, match := range matches {
-			if len(match) > 1 {
-				link := strings.TrimSpace(match[1])
+	fmt.Fprintln(Messages, "\nSearching for video links...")
 
-				// Skip empty links or special URIs
-				if link == "" || strings.HasPrefix(link, "javascript:") || strings.HasPrefix(link, "data:") {
-					continue
-				}
-
-				// Convert to absolute URL
-				var absoluteURL *url.URL
-				if strings.HasPrefix(link, "http") {
-					absoluteURL, err = url.Parse(link)
-				} else {
-					absoluteURL, err = baseURL.Parse(link)
-				}
-
-				if err != nil {
-					fmt.Printf("Warning: Failed to parse URL %s: %v\n", link, err)
-					continue
-				}
-
-				finalURL := absoluteURL.String()
-				if strings.Contains(strings.ToLower(finalURL), ".mp4") {
-					// Check for duplicates
-					duplicate := false
-					for _, existing := range mp4Links {
-						if existing == finalURL {
-							duplicate = true
-							break
-						}
-					}
-					if !duplicate {
-						fmt.Printf("Found MP4 link: %s\n", finalURL)
-						mp4Links = append(mp4Links, finalURL)
-					}
+	var candidates []string
+	walk(doc, func(n *html.Node) bool {
+		switch n.Type {
+		case html.ElementNode:
+			for _, a := range n.Attr {
+				candidates = append(candidates, strings.TrimSpace(a.Val))
+			}
+		case html.TextNode:
+			// Scripts often hold JSON with escaped slashes
+			text := strings.ReplaceAll(n.Data, `\/`, "/")
+			if n.Parent != nil && n.Parent.Data == "script" {
+				for _, match := range quotedStringRe.FindAllStringSubmatch(text, -1) {
+					candidates = append(candidates, match[1])
 				}
 			}
+			candidates = append(candidates, bareURLRe.FindAllString(text, -1)...)
 		}
-	}
-
-	if len(mp4Links) == 0 {
-		fmt.Println("\nNo direct MP4 links found. Analyzing all links...")
-		linkRe := regexp.MustCompile(`(?i)href\s*=\s*['"]([^'"]+)['"]`)
-		allMatches := linkRe.FindAllStringSubmatch(bodyString, -1)
-		fmt.Printf("Found %d total links to check\n", len(allMatches))
+		return true
+	})
 
-		for _, match := range allMatches {
-			if len(match) > 1 {
-				link := strings.TrimSpace(match[1])
-				if strings.Contains(strings.ToLower(link), ".mp4") {
-					var absoluteURL *url.URL
-					if strings.HasPrefix(link, "http") {
-						absoluteURL, err = url.Parse(link)
-					} else {
-						absoluteURL, err = baseURL.Parse(link)
-					}
+	var mp4Links []string
+	seen := make(map[string]bool)
+	for _, link := range candidates {
+		// Skip empty links, special URIs and anything that is not a video
+		lower := strings.ToLower(link)
+		if link == "" || strings.ContainsAny(link, " \t\n") || !isVideoLink(link) ||
+			strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "data:") {
+			continue
+		}
 
-					if err != nil {
-						fmt.Printf("Warning: Failed to parse URL %s: %v\n", link, err)
-						continue
-					}
+		// Convert to absolute URL
+		absoluteURL, err := baseURL.Parse(link)
+		if err != nil {
+			fmt.Fprintf(Messages, "Warning: Failed to parse URL %s: %v\n", link, err)
+			continue
+		}
 
-					finalURL := absoluteURL.String()
-					duplicate := false
-					for _, existing := range mp4Links {
-						if existing == finalURL {
-							duplicate = true
-							break
-						}
-					}
-					if !duplicate {
-						fmt.Printf("Found MP4 link (manual check): %s\n", finalURL)
-						mp4Links = append(mp4Links, finalURL)
-					}
-				}
-			}
+		finalURL := absoluteURL.String()
+		if pageURL == "" {
+			// A saved page without its URL keeps relative links as they are
+			finalURL = link
+		}
+		if !seen[finalURL] {
+			seen[finalURL] = true
+			fmt.Fprintf(Messages, "Found video link: %s\n", finalURL)
+			mp4Links = append(mp4Links, finalURL)
 		}
 	}
 
 	if len(mp4Links) == 0 {
-		fmt.Println("\nNo MP4 links found in the page")
+		fmt.Fprintln(Messages, "\nNo video links found in the page")
 	} else {
-		fmt.Printf("\nFound %d unique MP4 links\n", len(mp4Links))
+		fmt.Fprintf(Messages, "\nFound %d unique video links\n", len(mp4Links))
 	}
 
 	return mp4Links, nil
 }
+
+// isVideoLink reports whether a link points to an MP4 file, an HLS playlist
+// or a DASH manifest
+func isVideoLink(link string) bool {
+	link = strings.ToLower(link)
+	return strings.Contains(link, ".mp4") || strings.Contains(link, ".m3u8") || strings.Contains(link, ".mpd")
+}
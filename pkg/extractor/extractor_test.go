@@ -0,0 +1,208 @@
+package extractor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// checkInfo compares everything but the page order, which is checked
+// through Episodes
+func checkInfo(t *testing.T, got, want *TVSeriesInfo) {
+	t.Helper()
+	if got.Title != want.Title {
+		t.Errorf("Title = %q, want %q", got.Title, want.Title)
+	}
+	if got.Poster != want.Poster {
+		t.Errorf("Poster = %q, want %q", got.Poster, want.Poster)
+	}
+	if !reflect.DeepEqual(got.Links, want.Links) {
+		t.Errorf("Links = %q, want %q", got.Links, want.Links)
+	}
+	if !reflect.DeepEqual(got.SeasonNames(), want.SeasonNames()) {
+		t.Errorf("seasons = %q, want %q", got.SeasonNames(), want.SeasonNames())
+	}
+	for season, episodes := range want.Seasons {
+		if !reflect.DeepEqual(got.Seasons[season], episodes) {
+			t.Errorf("season %s:\ngot  %+v\nwant %+v", season, got.Seasons[season], episodes)
+		}
+	}
+}
+
+func episodeIDs(info *TVSeriesInfo) []string {
+	var ids []string
+	for _, ep := range info.Episodes() {
+		ids = append(ids, ep.ID)
+	}
+	return ids
+}
+
+func TestExtractTVSeriesInfo(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *TVSeriesInfo
+		order   []string
+	}{
+		{
+			fixture: "series_basic.html",
+			want: &TVSeriesInfo{
+				Title:  "Example Show & Friends",
+				Poster: "/images/series/example-show.jpg",
+				Seasons: map[string][]Episode{
+					"1": {
+						{ID: "S01E01", Season: 1, Episode: 1, Size: 245 << 20, Quality: "480p", Links: []string{
+							"https://dl1.example.net/Example.Show.S01E01.480p.mp4",
+							"https://dl2.example.net/Example.Show.S01E01.480p.mp4",
+						}},
+						{ID: "S01E02", Season: 1, Episode: 2, Size: 251 << 20, Quality: "480p", Links: []string{
+							"https://dl1.example.net/Example.Show.S01E02.480p.mp4",
+						}},
+						{ID: "S01E03", Season: 1, Episode: 3, Size: 239 << 20, Quality: "480p", Links: []string{
+							"https://dl1.example.net/Example.Show.S01E03.480p.mp4",
+						}},
+					},
+					"2": {
+						{ID: "S02E01", Season: 2, Episode: 1, Size: 310 << 20, Quality: "720p", Links: []string{
+							"https://dl1.example.net/Example.Show.S02E01.720p.mp4",
+						}},
+						{ID: "S02E02", Season: 2, Episode: 2, Size: 305 << 20, Quality: "720p", Links: []string{
+							"https://dl1.example.net/Example.Show.S02E02.720p.mp4",
+						}},
+					},
+				},
+			},
+			order: []string{"S01E01", "S01E02", "S01E03", "S02E01", "S02E02"},
+		},
+		{
+			// Attributes in another order, unquoted values, extra classes,
+			// tables and nested divs, and seasons listed newest first
+			fixture: "series_reordered.html",
+			want: &TVSeriesInfo{
+				Title:  "Another Show",
+				Poster: "https://cdn.example.org/posters/another-show.jpg",
+				Seasons: map[string][]Episode{
+					"1": {
+						{ID: "S01E01", Season: 1, Episode: 1, Size: 401 << 20, Links: []string{
+							"https://dl.example.org/another.show.s01e01.mp4",
+						}},
+						{ID: "S01E02", Season: 1, Episode: 2},
+					},
+					"2": {
+						{ID: "S02E01", Season: 2, Episode: 1, Size: 512 << 20, Links: []string{
+							"/files/another.show.s02e01.mp4",
+							"https://mirror.example.org/another.show.s02e01.mp4",
+						}},
+						{ID: "S02E02", Season: 2, Episode: 2, Size: 498 << 20, Links: []string{
+							"/files/another.show.s02e02.mp4",
+						}},
+					},
+				},
+			},
+			order: []string{"S02E01", "S02E02", "S01E01", "S01E02"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			info, err := ExtractTVSeriesInfo(readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("ExtractTVSeriesInfo: %v", err)
+			}
+			checkInfo(t, info, tt.want)
+			if got := episodeIDs(info); !reflect.DeepEqual(got, tt.order) {
+				t.Errorf("Episodes() = %q, want %q", got, tt.order)
+			}
+		})
+	}
+}
+
+func TestExtractPageSeries(t *testing.T) {
+	page := &Page{URL: "https://todaytvseries6.com/another-show", Body: readFixture(t, "series_reordered.html")}
+	links, info, err := ExtractPage(context.Background(), page)
+	if err != nil {
+		t.Fatalf("ExtractPage: %v", err)
+	}
+	if links != nil {
+		t.Errorf("links = %q, want none for a series page", links)
+	}
+	if info == nil {
+		t.Fatal("no series info")
+	}
+
+	// Relative links are resolved against the page
+	want := []string{
+		"https://todaytvseries6.com/files/another.show.s02e01.mp4",
+		"https://mirror.example.org/another.show.s02e01.mp4",
+	}
+	if got := info.Seasons["2"][0].Links; !reflect.DeepEqual(got, want) {
+		t.Errorf("S02E01 links = %q, want %q", got, want)
+	}
+	if got := info.Seasons["2"][1].Links; !reflect.DeepEqual(got, []string{"https://todaytvseries6.com/files/another.show.s02e02.mp4"}) {
+		t.Errorf("S02E02 links = %q", got)
+	}
+}
+
+func TestExtractPageGeneric(t *testing.T) {
+	defer func(w io.Writer) { Messages = w }(Messages)
+	Messages = io.Discard
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{
+			url: "https://site.example.com/watch/page.html",
+			want: []string{
+				"https://media.example.com/trailer.mp4",
+				"https://site.example.com/videos/intro.mp4",
+				"https://stream.example.com/hls/intro/master.m3u8",
+				"https://stream.example.com/dash/feature/manifest.mpd",
+				"https://cdn.example.com/clips/clip-01.mp4?token=abc",
+				"https://files.example.com/episode-05.mp4",
+				"https://site.example.com/watch/downloads/episode-06.mp4",
+				"https://cdn.example.com/hls/live-replay/index.m3u8",
+			},
+		},
+		{
+			// Without the page URL, relative links are kept as they are
+			url: "",
+			want: []string{
+				"https://media.example.com/trailer.mp4",
+				"/videos/intro.mp4",
+				"https://stream.example.com/hls/intro/master.m3u8",
+				"https://stream.example.com/dash/feature/manifest.mpd",
+				"//cdn.example.com/clips/clip-01.mp4?token=abc",
+				"https://files.example.com/episode-05.mp4",
+				"./downloads/episode-06.mp4",
+				"https://cdn.example.com/hls/live-replay/index.m3u8",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			page := &Page{URL: tt.url, Body: readFixture(t, "generic_player.html")}
+			links, info, err := ExtractPage(context.Background(), page)
+			if err != nil {
+				t.Fatalf("ExtractPage: %v", err)
+			}
+			if info != nil {
+				t.Errorf("got series info %+v for a page without episodes", info)
+			}
+			if !reflect.DeepEqual(links, tt.want) {
+				t.Errorf("links:\ngot  %q\nwant %q", links, tt.want)
+			}
+		})
+	}
+}
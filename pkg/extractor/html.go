@@ -0,0 +1,76 @@
+package extractor
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// parseHTML parses a page into a DOM tree
+func parseHTML(bodyString string) (*html.Node, error) {
+	return html.Parse(strings.NewReader(bodyString))
+}
+
+// walk calls fn for n and every node below it in document order. Children
+// are skipped when fn returns false.
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// findAll returns the elements below n for which match is true
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	walk(n, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && match(n) {
+			found = append(found, n)
+		}
+		return true
+	})
+	return found
+}
+
+// findFirst returns the first element below n for which match is true
+func findFirst(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if found := findAll(n, match); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// attr returns the value of an attribute, or "" if it is missing
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// hasClass reports whether an element has a class among its class names
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns the text below n with whitespace collapsed
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	walk(n, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -3,104 +3,250 @@ package extractor
 import (
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
 )
 
 // TVSeriesInfo contains information about available TV series seasons and episodes
 type TVSeriesInfo struct {
-	Title   string
-	Seasons map[string][]Episode
+	Title   string               `json:"title"`
+	Poster  string               `json:"poster,omitempty"` // poster image URL, empty if the page has none
+	Seasons map[string][]Episode `json:"seasons,omitempty"`
+	// Links are downloads that do not belong to an episode, as found on
+	// generic pages
+	Links []string `json:"links,omitempty"`
+
+	// pageOrder lists the seasons in the order the page shows them
+	pageOrder []string
 }
 
-// Episode represents a single episode with its links
+// Episode represents a single episode with its links. The metadata fields
+// are zero when the page doesn't show them.
 type Episode struct {
-	ID    string // e.g., "S01E01"
-	Links []string
+	ID      string `json:"id"` // e.g., "S01E01"
+	Season  int    `json:"season"`
+	Episode int    `json:"episode"`
+	// LastEpisode is the second number of a double episode such as
+	// S01E01E02, otherwise 0
+	LastEpisode int      `json:"last_episode,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Size        int64    `json:"size,omitempty"`    // in bytes, as listed on the page
+	Quality     string   `json:"quality,omitempty"` // e.g. "720p x265"
+	Links       []string `json:"links"`             // mirrors of the same file, best first
+}
+
+// Numbers returns the season and episode numbers encoded in the ID,
+// or zeros if the ID is not in SxxEyy form
+func (e Episode) Numbers() (season, episode int) {
+	n, _ := ParseEpisodeID(e.ID)
+	return n.Season, n.Episode
+}
+
+// Number returns the episode's position in the series
+func (e Episode) Number() EpisodeNumber {
+	if e.Season == 0 && e.Episode == 0 {
+		n, _ := ParseEpisodeID(e.ID)
+		return n
+	}
+	return EpisodeNumber{Season: e.Season, Episode: e.Episode, Last: e.LastEpisode}
 }
 
-// ExtractTVSeriesInfo extracts TV series information without prompting for selection
+// seasonHeadingRe matches the "Download Season N" headings of a series page
+var seasonHeadingRe = regexp.MustCompile(`(?i)Download Season\s+(\d+)`)
+
+// ExtractTVSeriesInfo extracts TV series information without prompting for selection.
+// Episodes are read from the page structure: every "cell2" element holding an
+// episode ID starts a row, and the links after it in that row are its mirrors.
 func ExtractTVSeriesInfo(bodyString string) (*TVSeriesInfo, error) {
+	doc, err := parseHTML(bodyString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %v", err)
+	}
+
 	// Extract available seasons
-	seasonsRe := regexp.MustCompile(`Download Season ([0-9]{1,})`)
-	seasonMatches := seasonsRe.FindAllStringSubmatch(bodyString, -1)
+	var seasons []string
+	walk(doc, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			for _, match := range seasonHeadingRe.FindAllStringSubmatch(n.Data, -1) {
+				seasons = appendUnique(seasons, match[1])
+			}
+		}
+		return true
+	})
+
+	// Find the episode cells
+	cells := findAll(doc, func(n *html.Node) bool {
+		return hasClass(n, "cell2") && episodeIDRe.MatchString(textContent(n))
+	})
+	isCell := make(map[*html.Node]bool)
+	for _, cell := range cells {
+		isCell[cell] = true
+	}
 
-	if len(seasonMatches) == 0 {
+	if len(seasons) == 0 && len(cells) == 0 {
 		return nil, fmt.Errorf("no seasons found")
 	}
 
 	// Extract title
-	titleRe := regexp.MustCompile(`uk-article-title uk-badge1">(.*)</h1>`)
-	titleMatch := titleRe.FindStringSubmatch(bodyString)
 	title := "TV Series"
-	if len(titleMatch) > 1 {
-		title = titleMatch[1]
+	if h1 := findFirst(doc, func(n *html.Node) bool {
+		return n.Data == "h1" && hasClass(n, "uk-article-title")
+	}); h1 != nil && textContent(h1) != "" {
+		title = textContent(h1)
 	}
 
 	info := &TVSeriesInfo{
 		Title:   title,
+		Poster:  extractPoster(doc),
 		Seasons: make(map[string][]Episode),
 	}
 
-	// Get unique seasons
-	seasonMap := make(map[string]bool)
-	for _, match := range seasonMatches {
-		if len(match) > 1 {
-			seasonMap[match[1]] = true
-		}
+	rows := newRowGrouper(info, seasons)
+	for _, cell := range cells {
+		text := textContent(cell)
+		links, rest := rowContents(cell, isCell)
+		rows.add(Episode{
+			ID:      normalizeID(text),
+			Title:   episodeTitle(text),
+			Size:    ParseSize(rest),
+			Quality: qualityTag(append([]string{text, rest}, linkNames(links)...)...),
+			Links:   links,
+		})
 	}
 
-	// Process each season
-	for season := range seasonMap {
-		seasonNum := fmt.Sprintf("%02s", season)
-		episodePattern := fmt.Sprintf(`<div class="cell2">(S%sE[0-9]{1,})`, seasonNum)
-		episodeRe := regexp.MustCompile(episodePattern)
-		episodeMatches := episodeRe.FindAllStringSubmatch(bodyString, -1)
-
-		// Use a map to deduplicate episodes
-		episodeMap := make(map[string]Episode)
-		for _, match := range episodeMatches {
-			if len(match) < 2 {
-				continue
-			}
+	return info, nil
+}
 
-			epID := match[1]
-			if _, exists := episodeMap[epID]; !exists {
-				episodeMap[epID] = Episode{ID: epID}
-			}
+// rowGrouper adds episode rows to the seasons of a TVSeriesInfo in page
+// order. Mirrors repeat the episode ID in another row, so their links are
+// added to the same episode.
+type rowGrouper struct {
+	info     *TVSeriesInfo
+	seasons  []string
+	position map[string]int
+}
 
-			// Find download links for this episode
-			linkPatterns := []string{
-				fmt.Sprintf(`%s</div><div class="cell[0-9]">[0-9]{1,} Mb</div><div class="cell[0-9]"><a href=['"]?([^'" >]+)['"]? class="hvr-icon-sink-away" target="_blank">.*</a></div>`, regexp.QuoteMeta(match[1])),
-				fmt.Sprintf(`%s[^<]*</div>[^<]*<div[^>]*>[^<]*[0-9]+\s*Mb[^<]*</div>[^<]*<div[^>]*><a\s+href=['"]([^'"]+)['"]`, regexp.QuoteMeta(match[1])),
-				fmt.Sprintf(`%s.*?href=['"]([^'"]+)['"].*?target="_blank"`, regexp.QuoteMeta(match[1])),
-				fmt.Sprintf(`%s.*?<a[^>]+href=['"]([^'"]+)['"]`, regexp.QuoteMeta(match[1])),
-			}
+func newRowGrouper(info *TVSeriesInfo, seasons []string) *rowGrouper {
+	return &rowGrouper{info: info, seasons: seasons, position: make(map[string]int)}
+}
 
-			ep := episodeMap[epID]
-			for _, pattern := range linkPatterns {
-				re := regexp.MustCompile(pattern)
-				linkMatch := re.FindStringSubmatch(bodyString)
-				if len(linkMatch) > 1 {
-					ep.Links = append(ep.Links, linkMatch[1])
-					episodeMap[epID] = ep
-					break
-				}
-			}
+// add records one row. A mirror row adds its links to the episode, and
+// fills in metadata the earlier rows didn't have.
+func (g *rowGrouper) add(row Episode) {
+	n, _ := ParseEpisodeID(row.ID)
+	season := seasonKey(g.seasons, n.Season)
 
-			if len(episodeMap[epID].Links) > 0 {
-				episodeMap[epID] = Episode{ID: epID, Links: episodeMap[epID].Links}
-			}
+	i, exists := g.position[row.ID]
+	if !exists {
+		if _, known := g.info.Seasons[season]; !known {
+			g.info.pageOrder = append(g.info.pageOrder, season)
 		}
+		i = len(g.info.Seasons[season])
+		g.position[row.ID] = i
+		g.info.Seasons[season] = append(g.info.Seasons[season], Episode{
+			ID:          row.ID,
+			Season:      n.Season,
+			Episode:     n.Episode,
+			LastEpisode: n.Last,
+		})
+	}
 
-		// Convert map to slice
-		var episodes []Episode
-		for _, ep := range episodeMap {
-			episodes = append(episodes, ep)
+	ep := &g.info.Seasons[season][i]
+	for _, link := range row.Links {
+		ep.Links = appendUnique(ep.Links, link)
+	}
+	if ep.Title == "" {
+		ep.Title = row.Title
+	}
+	if ep.Size == 0 {
+		ep.Size = row.Size
+	}
+	if ep.Quality == "" {
+		ep.Quality = row.Quality
+	}
+}
+
+// seasonKey returns the season name used on the page for a season number,
+// so "Download Season 01" and S01E02 end up together
+func seasonKey(seasons []string, number int) string {
+	for _, season := range seasons {
+		if n, err := strconv.Atoi(season); err == nil && n == number {
+			return season
 		}
+	}
+	return strconv.Itoa(number)
+}
 
-		if len(episodes) > 0 {
-			info.Seasons[season] = episodes
+// rowContents returns the links and the text that follow an episode cell
+// in its row, up to the next episode cell. The row is the cell's parent, or
+// its grandparent when the size and link cells are wrapped separately.
+func rowContents(cell *html.Node, isCell map[*html.Node]bool) (links []string, text string) {
+	container := cell.Parent
+	for level := 0; level < 2 && container != nil; level++ {
+		var texts []string
+		links = nil
+		started, done := false, false
+		walk(container, func(n *html.Node) bool {
+			switch {
+			case done:
+				return false
+			case n == cell:
+				started = true
+				return false
+			case !started:
+				return true
+			case n.Type == html.TextNode:
+				texts = append(texts, n.Data)
+				return true
+			case n.Type != html.ElementNode:
+				return true
+			case isCell[n]:
+				done = true
+				return false
+			}
+			if href := attr(n, "href"); n.Data == "a" && isDownloadHref(href) {
+				links = appendUnique(links, href)
+			}
+			return true
+		})
+		if len(links) > 0 {
+			return links, strings.Join(strings.Fields(strings.Join(texts, " ")), " ")
 		}
+		container = container.Parent
 	}
+	return nil, ""
+}
 
-	return info, nil
+// isDownloadHref reports whether an anchor target can be a download
+func isDownloadHref(href string) bool {
+	lower := strings.ToLower(href)
+	return href != "" && !strings.HasPrefix(href, "#") &&
+		!strings.HasPrefix(lower, "javascript:") && !strings.HasPrefix(lower, "mailto:")
+}
+
+// extractPoster finds the series poster, preferring the Open Graph image
+func extractPoster(doc *html.Node) string {
+	if meta := findFirst(doc, func(n *html.Node) bool {
+		return n.Data == "meta" && strings.EqualFold(attr(n, "property"), "og:image") && attr(n, "content") != ""
+	}); meta != nil {
+		return attr(meta, "content")
+	}
+	if img := findFirst(doc, func(n *html.Node) bool {
+		return n.Data == "img" && strings.EqualFold(attr(n, "itemprop"), "image") && attr(n, "src") != ""
+	}); img != nil {
+		return attr(img, "src")
+	}
+	return ""
+}
+
+// appendUnique appends link unless it is already in links
+func appendUnique(links []string, link string) []string {
+	for _, existing := range links {
+		if existing == link {
+			return links
+		}
+	}
+	return append(links, link)
 }
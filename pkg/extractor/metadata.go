@@ -0,0 +1,100 @@
+package extractor
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sizeRe matches sizes such as "245 Mb", "1.4 GB" or "700MiB"
+var sizeRe = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?)\s*([KMGT])i?B\b`)
+
+// ParseSize reads the first size in s as a number of bytes, or returns 0 if
+// there is none. Sites write megabytes as "Mb", so units are read as bytes
+// and with binary multiples.
+func ParseSize(s string) int64 {
+	match := sizeRe.FindStringSubmatch(s)
+	if match == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0
+	}
+	shift := map[string]uint{"K": 10, "M": 20, "G": 30, "T": 40}[strings.ToUpper(match[2])]
+	return int64(value * float64(int64(1)<<shift))
+}
+
+// FormatSize renders a size in bytes for display
+func FormatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.0f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// qualityRe matches resolution, codec and source tags in release names
+var qualityRe = regexp.MustCompile(`(?i)^(2160p|1440p|1080p|720p|576p|480p|360p|4k|x26[45]|h26[45]|hevc|av1|10bit|web-?dl|web-?rip|blu-?ray|brrip|hdtv|hdr)$`)
+
+// qualityTag collects the quality tags found in the given texts, such as
+// "720p x265", in the order they first appear
+func qualityTag(texts ...string) string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		// Dashes are kept inside words for tags like WEB-DL
+		for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+			return strings.ContainsRune(" ._[](),", r)
+		}) {
+			if qualityRe.MatchString(word) {
+				tag := strings.ToLower(word)
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// linkNames returns the file names of links, for finding quality tags
+func linkNames(links []string) []string {
+	var names []string
+	for _, link := range links {
+		if u, err := url.Parse(link); err == nil {
+			names = append(names, path.Base(u.Path))
+		}
+	}
+	return names
+}
+
+// episodeTitle returns the title written after an episode ID, as in
+// "S01E02 - The Return", or "" if there is none
+func episodeTitle(text string) string {
+	loc := episodeIDRe.FindStringIndex(strings.TrimSpace(text))
+	if loc == nil {
+		return ""
+	}
+	title := strings.TrimSpace(text)[loc[1]:]
+	return strings.TrimSpace(strings.TrimLeft(title, " -–—:.|"))
+}
+
+// fillNumbers sets the season and episode numbers of episodes that only
+// have an ID
+func fillNumbers(info *TVSeriesInfo) {
+	for _, episodes := range info.Seasons {
+		for i := range episodes {
+			n := episodes[i].Number()
+			episodes[i].Season, episodes[i].Episode, episodes[i].LastEpisode = n.Season, n.Episode, n.Last
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// episodeIDRe matches episode IDs such as S01E02, and double episodes such
+// as S01E01E02 or S01E01-E02
+var episodeIDRe = regexp.MustCompile(`(?i)^S(\d+)E(\d+)(?:-?E(\d+))?`)
+
+// EpisodeNumber identifies an episode by number. Specials are in season 0.
+// A double episode such as S01E01E02 has Last set to its second episode.
+type EpisodeNumber struct {
+	Season  int
+	Episode int
+	Last    int
+}
+
+// ParseEpisodeID reads an ID in SxxEyy or SxxEyyEzz form
+func ParseEpisodeID(id string) (EpisodeNumber, bool) {
+	match := episodeIDRe.FindStringSubmatch(strings.TrimSpace(id))
+	if match == nil {
+		return EpisodeNumber{}, false
+	}
+	var n EpisodeNumber
+	n.Season, _ = strconv.Atoi(match[1])
+	n.Episode, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		n.Last, _ = strconv.Atoi(match[3])
+		if n.Last <= n.Episode {
+			n.Last = 0
+		}
+	}
+	return n, true
+}
+
+// String returns the canonical ID, e.g. S01E02 or S01E01E02
+func (n EpisodeNumber) String() string {
+	id := fmt.Sprintf("S%02dE%02d", n.Season, n.Episode)
+	if n.Last > 0 {
+		id += fmt.Sprintf("E%02d", n.Last)
+	}
+	return id
+}
+
+// IsSpecial reports whether the episode is a special (season 0)
+func (n EpisodeNumber) IsSpecial() bool {
+	return n.Season == 0
+}
+
+// Covers reports whether episode is part of this one, which for a double
+// episode is either of its numbers
+func (n EpisodeNumber) Covers(episode int) bool {
+	if n.Last > 0 {
+		return episode >= n.Episode && episode <= n.Last
+	}
+	return episode == n.Episode
+}
+
+// Compare orders episodes by season and episode number, with specials
+// after the regular seasons. It returns -1, 0 or 1.
+func (n EpisodeNumber) Compare(other EpisodeNumber) int {
+	if c := compareSeasonNumbers(n.Season, other.Season); c != 0 {
+		return c
+	}
+	if n.Episode != other.Episode {
+		return compareInts(n.Episode, other.Episode)
+	}
+	return compareInts(n.Last, other.Last)
+}
+
+// normalizeID returns the canonical form of the episode ID at the start of
+// text, or "" if there is none
+func normalizeID(text string) string {
+	if n, ok := ParseEpisodeID(text); ok {
+		return n.String()
+	}
+	return ""
+}
+
+// SortSeasons sorts season names in natural order: numbered seasons by
+// number with specials (season 0) last, then other names alphabetically
+func SortSeasons(seasons []string) {
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return compareSeasons(seasons[i], seasons[j]) < 0
+	})
+}
+
+// SeasonLabel returns the display name of a season
+func SeasonLabel(season string) string {
+	n, err := strconv.Atoi(season)
+	switch {
+	case err != nil:
+		return season
+	case n == 0:
+		return "Specials"
+	}
+	return "Season " + season
+}
+
+// compareSeasons orders two season names for SortSeasons
+func compareSeasons(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		if c := compareSeasonNumbers(na, nb); c != 0 {
+			return c
+		}
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareSeasonNumbers orders season numbers with specials last
+func compareSeasonNumbers(a, b int) int {
+	switch {
+	case a == b:
+		return 0
+	case a == 0:
+		return 1
+	case b == 0:
+		return -1
+	}
+	return compareInts(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// SeasonNames returns the seasons in natural order
+func (info *TVSeriesInfo) SeasonNames() []string {
+	var seasons []string
+	for season := range info.Seasons {
+		seasons = append(seasons, season)
+	}
+	SortSeasons(seasons)
+	return seasons
+}
+
+// Episodes returns every episode in the order the page lists them. Seasons
+// not read from a page, such as those sent by a plugin, follow in natural
+// order.
+func (info *TVSeriesInfo) Episodes() []Episode {
+	var episodes []Episode
+	done := make(map[string]bool)
+	for _, season := range append(append([]string{}, info.pageOrder...), info.SeasonNames()...) {
+		if done[season] {
+			continue
+		}
+		done[season] = true
+		episodes = append(episodes, info.Seasons[season]...)
+	}
+	return episodes
+}
@@ -0,0 +1,273 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// PluginProtocolVersion is the version of the JSON protocol spoken with
+// provider plugins. Plugins answering with another version are not used.
+const PluginProtocolVersion = 1
+
+// PluginPrefix starts the file name of every provider plugin
+const PluginPrefix = "tt6d-provider-"
+
+// Time limits for plugin calls
+var (
+	PluginHandshakeTimeout = 5 * time.Second
+	PluginTimeout          = 60 * time.Second
+)
+
+// pluginRequest is written to a plugin's stdin, one per run
+type pluginRequest struct {
+	Protocol int    `json:"protocol"`
+	Action   string `json:"action"` // "hello", "extract" or "resolve"
+	URL      string `json:"url,omitempty"`
+	HTML     string `json:"html,omitempty"`
+	Link     string `json:"link,omitempty"`
+}
+
+// pluginHello is a plugin's answer to the handshake
+type pluginHello struct {
+	Protocol int      `json:"protocol"`
+	Name     string   `json:"name"`
+	Domains  []string `json:"domains"`
+	Priority *int     `json:"priority"`
+	Resolve  bool     `json:"resolve"`
+	Error    string   `json:"error"`
+}
+
+// pluginResult is a plugin's answer to extract or resolve. Extract may also
+// be answered with a plain JSON array of links.
+type pluginResult struct {
+	TVSeriesInfo
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// PluginProvider is a Provider backed by an external program that reads a
+// JSON request on stdin and writes a JSON response on stdout
+type PluginProvider struct {
+	Name     string
+	Path     string
+	Domains  []string
+	Priority int
+	resolve  bool
+}
+
+// DefaultPluginDir returns the folder searched for plugins before PATH,
+// ~/.config/tt6d/plugins on Linux
+func DefaultPluginDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tt6d", "plugins")
+}
+
+// DiscoverPlugins returns the plugin executables in dirs and then on PATH.
+// When two have the same name, the first one found is used.
+func DiscoverPlugins(dirs ...string) []string {
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, PluginPrefix) {
+				continue
+			}
+			key := strings.TrimSuffix(name, filepath.Ext(name))
+			if seen[key] || !isExecutable(filepath.Join(dir, name)) {
+				continue
+			}
+			seen[key] = true
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths
+}
+
+// isExecutable reports whether path is a file that can be run
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".bat", ".cmd", ".com":
+			return true
+		}
+		return false
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+// LoadPlugin runs the handshake with a plugin and returns a provider for it
+func LoadPlugin(ctx context.Context, path string) (*PluginProvider, error) {
+	var hello pluginHello
+	if err := runPlugin(ctx, path, PluginHandshakeTimeout, pluginRequest{Action: "hello"}, &hello); err != nil {
+		return nil, err
+	}
+	if hello.Error != "" {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(path), hello.Error)
+	}
+	if hello.Protocol != PluginProtocolVersion {
+		return nil, fmt.Errorf("%s: speaks protocol version %d, expected %d", filepath.Base(path), hello.Protocol, PluginProtocolVersion)
+	}
+	if len(hello.Domains) == 0 {
+		return nil, fmt.Errorf("%s: handshake lists no domains", filepath.Base(path))
+	}
+
+	p := &PluginProvider{
+		Name:     hello.Name,
+		Path:     path,
+		Priority: PrioritySite + 10,
+		resolve:  hello.Resolve,
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), PluginPrefix)
+	}
+	if hello.Priority != nil {
+		p.Priority = *hello.Priority
+	}
+	for _, domain := range hello.Domains {
+		p.Domains = append(p.Domains, strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*.")))
+	}
+	return p, nil
+}
+
+// RegisterPlugins loads the plugins found in dirs and on PATH and registers
+// each as a provider named "plugin:<name>". Plugins that fail the handshake
+// are left out and reported in the returned errors.
+func RegisterPlugins(ctx context.Context, dirs ...string) []error {
+	var errs []error
+	for _, path := range DiscoverPlugins(dirs...) {
+		p, err := LoadPlugin(ctx, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		Register("plugin:"+p.Name, p.Priority, p)
+	}
+	return errs
+}
+
+// Match reports whether pageURL is on one of the plugin's domains
+func (p *PluginProvider) Match(pageURL string) bool {
+	return matchDomain(pageURL, p.Domains)
+}
+
+// Extract sends the page to the plugin
+func (p *PluginProvider) Extract(ctx context.Context, page *Page) (*TVSeriesInfo, error) {
+	var raw json.RawMessage
+	req := pluginRequest{Action: "extract", URL: page.URL, HTML: page.Body}
+	if err := runPlugin(ctx, p.Path, PluginTimeout, req, &raw); err != nil {
+		return nil, err
+	}
+
+	// A flat list of links is a generic page
+	var links []string
+	if err := json.Unmarshal(raw, &links); err == nil {
+		if len(links) == 0 {
+			return nil, fmt.Errorf("plugin %s found no links", p.Name)
+		}
+		return &TVSeriesInfo{Links: links}, nil
+	}
+
+	var result pluginResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("plugin %s sent an invalid response: %v", p.Name, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", p.Name, result.Error)
+	}
+	info := result.TVSeriesInfo
+	if len(info.Seasons) == 0 && len(info.Links) == 0 {
+		return nil, fmt.Errorf("plugin %s found no episodes or links", p.Name)
+	}
+	if len(info.Seasons) > 0 && info.Title == "" {
+		info.Title = "TV Series"
+	}
+	fillNumbers(&info)
+	return &info, nil
+}
+
+// Resolve asks the plugin for the direct URL of a link, if the plugin said
+// in the handshake that it resolves links
+func (p *PluginProvider) Resolve(ctx context.Context, link string) (string, error) {
+	if !p.resolve {
+		return link, nil
+	}
+	var result pluginResult
+	if err := runPlugin(ctx, p.Path, PluginTimeout, pluginRequest{Action: "resolve", Link: link}, &result); err != nil {
+		return "", err
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("plugin %s: %s", p.Name, result.Error)
+	}
+	if result.URL == "" {
+		return "", fmt.Errorf("plugin %s returned no URL for %s", p.Name, link)
+	}
+	return result.URL, nil
+}
+
+// runPlugin runs a plugin once with req on stdin and decodes its stdout
+// into response
+func runPlugin(ctx context.Context, path string, timeout time.Duration, req pluginRequest, response interface{}) error {
+	req.Protocol = PluginProtocolVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for grandchildren holding the pipes open after a timeout
+	cmd.WaitDelay = time.Second
+
+	name := filepath.Base(path)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s: no answer within %v", name, timeout)
+		}
+		if msg := lastLine(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %v: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), response); err != nil {
+		return fmt.Errorf("%s: invalid response: %v", name, err)
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,135 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Page is a fetched web page
+type Page struct {
+	URL  string
+	Body string
+}
+
+// Provider reads series and download links from the pages of one kind of site
+type Provider interface {
+	// Match reports whether the provider understands pages at pageURL
+	Match(pageURL string) bool
+	// Extract reads the page. Pages without a series return a TVSeriesInfo
+	// with only Links set.
+	Extract(ctx context.Context, page *Page) (*TVSeriesInfo, error)
+}
+
+// Resolver is implemented by providers whose links lead to an intermediate
+// page, such as a file host's landing page, rather than to the file itself
+type Resolver interface {
+	// Resolve turns a link found by Extract into a direct download URL.
+	// Links that are already direct should be returned unchanged.
+	Resolve(ctx context.Context, link string) (string, error)
+}
+
+// Priorities of the built-in providers. Providers with a higher priority
+// are asked first, so site providers can be registered above PrioritySite
+// to take over from the built-in ones.
+const (
+	PrioritySite    = 100
+	PriorityGeneric = 0
+)
+
+type registration struct {
+	name     string
+	priority int
+	provider Provider
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+// Register adds a provider under a name. Registering a name again replaces
+// the earlier provider. Providers with equal priority are asked in the
+// order they were registered.
+func Register(name string, priority int, p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, r := range registry {
+		if r.name == name {
+			registry = append(registry[:i], registry[i+1:]...)
+			break
+		}
+	}
+	registry = append(registry, registration{name: name, priority: priority, provider: p})
+	sort.SliceStable(registry, func(i, j int) bool {
+		return registry[i].priority > registry[j].priority
+	})
+}
+
+// Providers returns the names of the registered providers in the order
+// they are asked
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for _, r := range registry {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// matching returns the providers that match pageURL, highest priority first.
+// An empty URL, as for a saved page, matches every provider.
+func matching(pageURL string) []registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var found []registration
+	for _, r := range registry {
+		if pageURL == "" || r.provider.Match(pageURL) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// extractPage asks each matching provider in turn until one succeeds
+func extractPage(ctx context.Context, page *Page) (*TVSeriesInfo, error) {
+	providers := matching(page.URL)
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no provider for %s", page.URL)
+	}
+
+	var lastErr error
+	for _, r := range providers {
+		info, err := r.provider.Extract(ctx, page)
+		if err == nil {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = fmt.Errorf("%s: %w", r.name, err)
+	}
+	return nil, lastErr
+}
+
+// Resolve turns a link found on pageURL into a direct download URL using
+// the provider for that page. Links are returned unchanged if the provider
+// does not implement Resolver.
+func Resolve(ctx context.Context, pageURL, link string) (string, error) {
+	if pageURL == "" {
+		return link, nil
+	}
+	providers := matching(pageURL)
+	if len(providers) == 0 {
+		return link, nil
+	}
+	if resolver, ok := providers[0].provider.(Resolver); ok {
+		return resolver.Resolve(ctx, link)
+	}
+	return link, nil
+}
@@ -0,0 +1,412 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SiteRules describes how to read the series pages of one site. Each part
+// of the page is found with a CSS selector, a regular expression, or both:
+// with both, the regex is applied to the text of the selected elements; with
+// only a regex, it is applied to the HTML. A regex with a single capture
+// group yields the group instead of the whole match.
+type SiteRules struct {
+	Name    string   `toml:"name"`
+	Domains []string `toml:"domains"`
+	// Priority defaults to just above the built-in providers
+	Priority *int `toml:"priority"`
+
+	Title       string `toml:"title"`
+	TitleRegex  string `toml:"title_regex"`
+	Season      string `toml:"season"`
+	SeasonRegex string `toml:"season_regex"`
+	// Row finds one element per episode row (or mirror row); the fields
+	// below are looked up inside each row
+	Row      string `toml:"row"`
+	RowRegex string `toml:"row_regex"`
+	// ID gives the episode ID. A regex with two groups is read as the
+	// season and episode numbers, and a third as the last episode of a
+	// double episode.
+	ID                string `toml:"id"`
+	IDRegex           string `toml:"id_regex"`
+	EpisodeTitle      string `toml:"episode_title"`
+	EpisodeTitleRegex string `toml:"episode_title_regex"`
+	Size              string `toml:"size"`
+	SizeRegex         string `toml:"size_regex"`
+	// Quality gives a tag such as "720p x265"; without it, tags are looked
+	// for in the row and the link file names
+	Quality      string `toml:"quality"`
+	QualityRegex string `toml:"quality_regex"`
+	// Link selects anchors (their href is used) or other elements with
+	// a src attribute
+	Link      string `toml:"link"`
+	LinkRegex string `toml:"link_regex"`
+}
+
+// rulesFile is the layout of a rules file
+type rulesFile struct {
+	Sites []SiteRules `toml:"site"`
+}
+
+// RulesProvider is a Provider built from SiteRules
+type RulesProvider struct {
+	Name     string
+	Domains  []string
+	Priority int
+
+	title, season, row, id, episodeTitle, size, quality, link rule
+}
+
+// rule is a compiled selector and/or regex
+type rule struct {
+	sel cascadia.Sel
+	re  *regexp.Regexp
+}
+
+// RuleResult is what a site's rules found on a page
+type RuleResult struct {
+	Title   string
+	Seasons []string
+	Rows    []RuleRow
+}
+
+// RuleRow is one episode or mirror row
+type RuleRow struct {
+	ID      string // normalized to SxxEyy, empty if no ID was found
+	RawID   string
+	Title   string
+	Size    string
+	Quality string
+	Links   []string
+}
+
+// DefaultRulesPath returns the rules file loaded when none is given,
+// ~/.config/tt6d/rules.toml on Linux
+func DefaultRulesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tt6d", "rules.toml")
+}
+
+// LoadRules reads a TOML rules file with one [[site]] table per site
+func LoadRules(path string) ([]*RulesProvider, error) {
+	var file rulesFile
+	meta, err := toml.DecodeFile(path, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %v", err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+	}
+	if len(file.Sites) == 0 {
+		return nil, fmt.Errorf("%s: no [[site]] rules", path)
+	}
+
+	var providers []*RulesProvider
+	for i, site := range file.Sites {
+		p, err := site.compile()
+		if err != nil {
+			name := site.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("%s: site %s: %v", path, name, err)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// RegisterRules loads a rules file and registers every site in it as a
+// provider named "rules:<name>"
+func RegisterRules(path string) error {
+	providers, err := LoadRules(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		Register("rules:"+p.Name, p.Priority, p)
+	}
+	return nil
+}
+
+// compile checks the rules and builds a provider from them
+func (s SiteRules) compile() (*RulesProvider, error) {
+	if len(s.Domains) == 0 {
+		return nil, fmt.Errorf("no domains")
+	}
+	p := &RulesProvider{Name: s.Name, Priority: PrioritySite + 10}
+	if p.Name == "" {
+		p.Name = s.Domains[0]
+	}
+	if s.Priority != nil {
+		p.Priority = *s.Priority
+	}
+	for _, domain := range s.Domains {
+		p.Domains = append(p.Domains, strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*.")))
+	}
+
+	fields := []struct {
+		name      string
+		css, re   string
+		target    *rule
+		required  bool
+		defaultRe string
+	}{
+		{"title", s.Title, s.TitleRegex, &p.title, false, ""},
+		{"season", s.Season, s.SeasonRegex, &p.season, false, `(\d+)`},
+		{"row", s.Row, s.RowRegex, &p.row, true, ""},
+		{"id", s.ID, s.IDRegex, &p.id, true, ""},
+		{"episode_title", s.EpisodeTitle, s.EpisodeTitleRegex, &p.episodeTitle, false, ""},
+		{"size", s.Size, s.SizeRegex, &p.size, false, ""},
+		{"quality", s.Quality, s.QualityRegex, &p.quality, false, ""},
+		{"link", s.Link, s.LinkRegex, &p.link, true, ""},
+	}
+	for _, f := range fields {
+		if f.css == "" && f.re == "" {
+			if f.required {
+				return nil, fmt.Errorf("%s needs a selector or a regex", f.name)
+			}
+			continue
+		}
+		if f.css != "" {
+			sel, err := cascadia.Parse(f.css)
+			if err != nil {
+				return nil, fmt.Errorf("%s selector: %v", f.name, err)
+			}
+			f.target.sel = sel
+		}
+		pattern := f.re
+		if pattern == "" && f.css != "" {
+			pattern = f.defaultRe
+		}
+		if pattern != "" {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s regex: %v", f.name, err)
+			}
+			f.target.re = re
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether pageURL is on one of the provider's domains or
+// their subdomains
+func (p *RulesProvider) Match(pageURL string) bool {
+	return matchDomain(pageURL, p.Domains)
+}
+
+// matchDomain reports whether pageURL is on one of domains or their
+// subdomains
+func matchDomain(pageURL string, domains []string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract reads the series from a page using the rules
+func (p *RulesProvider) Extract(ctx context.Context, page *Page) (*TVSeriesInfo, error) {
+	doc, err := parseHTML(page.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %v", err)
+	}
+	result := p.apply(doc)
+
+	info := &TVSeriesInfo{
+		Title:   result.Title,
+		Poster:  extractPoster(doc),
+		Seasons: make(map[string][]Episode),
+	}
+	if info.Title == "" {
+		info.Title = "TV Series"
+	}
+
+	rows := newRowGrouper(info, result.Seasons)
+	for _, row := range result.Rows {
+		if row.ID != "" {
+			rows.add(Episode{
+				ID:      row.ID,
+				Title:   row.Title,
+				Size:    ParseSize(row.Size),
+				Quality: row.Quality,
+				Links:   row.Links,
+			})
+		}
+	}
+
+	if len(info.Seasons) == 0 {
+		return nil, fmt.Errorf("rules for %s found no episodes", p.Name)
+	}
+	return info, nil
+}
+
+// Apply runs the rules over a page and reports everything they found,
+// including rows without an episode ID
+func (p *RulesProvider) Apply(body string) (*RuleResult, error) {
+	doc, err := parseHTML(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %v", err)
+	}
+	return p.apply(doc), nil
+}
+
+func (p *RulesProvider) apply(doc *html.Node) *RuleResult {
+	result := &RuleResult{}
+	if titles := p.title.values(doc, ""); len(titles) > 0 {
+		result.Title = titles[0]
+	}
+	for _, season := range p.season.values(doc, "") {
+		result.Seasons = appendUnique(result.Seasons, season)
+	}
+
+	for _, row := range p.row.nodes(doc) {
+		r := RuleRow{Links: p.link.values(row, "href")}
+		if ids := p.id.values(row, ""); len(ids) > 0 {
+			r.RawID = ids[0]
+			r.ID = normalizeEpisodeID(p.id.re, ids[0])
+		}
+		if titles := p.episodeTitle.values(row, ""); len(titles) > 0 {
+			r.Title = titles[0]
+		}
+		if sizes := p.size.values(row, ""); len(sizes) > 0 {
+			r.Size = sizes[0]
+		}
+		if qualities := p.quality.values(row, ""); len(qualities) > 0 {
+			r.Quality = qualities[0]
+		} else {
+			r.Quality = qualityTag(append([]string{textContent(row)}, linkNames(r.Links)...)...)
+		}
+		result.Rows = append(result.Rows, r)
+	}
+	return result
+}
+
+// normalizeEpisodeID turns an ID into SxxEyy form, or returns "" if it is
+// not an episode ID. A regex with two groups gives the numbers directly; a
+// third group gives the second episode of a double episode.
+func normalizeEpisodeID(re *regexp.Regexp, raw string) string {
+	if re != nil && re.NumSubexp() >= 2 {
+		if m := re.FindStringSubmatch(raw); m != nil {
+			var n EpisodeNumber
+			var err1, err2 error
+			n.Season, err1 = strconv.Atoi(m[1])
+			n.Episode, err2 = strconv.Atoi(m[2])
+			if len(m) > 3 && m[3] != "" {
+				if last, err := strconv.Atoi(m[3]); err == nil && last > n.Episode {
+					n.Last = last
+				}
+			}
+			if err1 == nil && err2 == nil {
+				return n.String()
+			}
+		}
+	}
+	return normalizeID(raw)
+}
+
+// nodes returns the elements a rule selects below root. A regex-only rule
+// matches the HTML of root and parses every match as a fragment.
+func (r rule) nodes(root *html.Node) []*html.Node {
+	if r.sel != nil {
+		return cascadia.QueryAll(root, r.sel)
+	}
+	if r.re == nil {
+		return nil
+	}
+
+	var nodes []*html.Node
+	for _, match := range r.re.FindAllString(renderHTML(root), -1) {
+		fragment, err := html.ParseFragment(strings.NewReader(match), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+		if err != nil {
+			continue
+		}
+		wrapper := &html.Node{Type: html.ElementNode, Data: "div"}
+		for _, n := range fragment {
+			wrapper.AppendChild(n)
+		}
+		nodes = append(nodes, wrapper)
+	}
+	return nodes
+}
+
+// values returns the strings a rule extracts below root: the text of the
+// selected elements, or their attribute if one is given, filtered through
+// the first match of the regex. A regex-only rule takes every match in the
+// HTML of root.
+func (r rule) values(root *html.Node, attribute string) []string {
+	var inputs []string
+	switch {
+	case r.sel != nil:
+		for _, n := range cascadia.QueryAll(root, r.sel) {
+			if attribute == "" {
+				inputs = append(inputs, textContent(n))
+			} else if v := attr(n, attribute); v != "" {
+				inputs = append(inputs, v)
+			} else if v := attr(n, "src"); v != "" {
+				inputs = append(inputs, v)
+			}
+		}
+	case r.re != nil:
+		inputs = []string{renderHTML(root)}
+	default:
+		return nil
+	}
+
+	if r.re == nil {
+		return inputs
+	}
+	matches := -1
+	if r.sel != nil {
+		matches = 1
+	}
+	var values []string
+	for _, input := range inputs {
+		for _, m := range r.re.FindAllStringSubmatch(input, matches) {
+			value := m[0]
+			if len(m) == 2 {
+				value = m[1]
+			}
+			if value = strings.TrimSpace(html.UnescapeString(value)); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// renderHTML turns a node back into HTML for regex matching
+func renderHTML(n *html.Node) string {
+	var buf bytes.Buffer
+	if n.Type == html.ElementNode && n.Data == "div" && n.Parent == nil {
+		// A wrapper made by nodes(); only its children are page content
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&buf, c)
+		}
+		return buf.String()
+	}
+	html.Render(&buf, n)
+	return buf.String()
+}
@@ -0,0 +1,250 @@
+package extractor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadRules writes a rules file and loads its single site
+func loadRules(t *testing.T, rules string) *RulesProvider {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	providers, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	return providers[0]
+}
+
+func TestLoadRulesExample(t *testing.T) {
+	providers, err := LoadRules(filepath.Join("testdata", "rules.toml"))
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	if len(providers) != 1 {
+		t.Fatalf("got %d providers, want 1", len(providers))
+	}
+	p := providers[0]
+	if p.Name != "example" || p.Priority != PrioritySite+10 || !reflect.DeepEqual(p.Domains, []string{"example.com"}) {
+		t.Errorf("provider %s with priority %d and domains %q", p.Name, p.Priority, p.Domains)
+	}
+
+	for pageURL, want := range map[string]bool{
+		"https://example.com/show":       true,
+		"https://www.Example.com/show":   true,
+		"https://notexample.com/show":    false,
+		"https://example.com.evil/show":  false,
+		"":                               false,
+		"https://todaytvseries6.com/abc": false,
+	} {
+		if got := p.Match(pageURL); got != want {
+			t.Errorf("Match(%q) = %v, want %v", pageURL, got, want)
+		}
+	}
+
+	body := readFixture(t, "series_basic.html")
+	result, err := p.Apply(body)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if result.Title != "Example Show & Friends" {
+		t.Errorf("Title = %q", result.Title)
+	}
+	if !reflect.DeepEqual(result.Seasons, []string{"1", "2"}) {
+		t.Errorf("Seasons = %q, want 1 and 2", result.Seasons)
+	}
+	if len(result.Rows) != 6 {
+		t.Fatalf("got %d rows, want 6", len(result.Rows))
+	}
+	wantRow := RuleRow{
+		ID: "S01E01", RawID: "S01E01", Size: "246 Mb", Quality: "480p",
+		Links: []string{"https://dl2.example.net/Example.Show.S01E01.480p.mp4"},
+	}
+	if !reflect.DeepEqual(result.Rows[1], wantRow) {
+		t.Errorf("mirror row:\ngot  %+v\nwant %+v", result.Rows[1], wantRow)
+	}
+
+	// The example rules read the page just as the built-in provider does
+	info, err := p.Extract(context.Background(), &Page{URL: "https://example.com/show", Body: body})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	builtin, err := ExtractTVSeriesInfo(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInfo(t, info, builtin)
+	if got, want := episodeIDs(info), episodeIDs(builtin); !reflect.DeepEqual(got, want) {
+		t.Errorf("Episodes() = %q, want %q", got, want)
+	}
+}
+
+func TestRulesEpisodeID(t *testing.T) {
+	tests := []struct {
+		name    string
+		idRegex string
+		text    string
+		rawID   string
+		id      string
+	}{
+		{"no regex", "", "S01E02", "S01E02", "S01E02"},
+		// A single group is the ID, which is then parsed as usual
+		{"single group", `Episode (\S+)`, "Episode s1e3 (720p)", "s1e3", "S01E03"},
+		{"single group that is not an ID", `Staffel (\d+)`, "Staffel 2 Folge 7", "2", ""},
+		// Two groups are the season and episode numbers
+		{"two groups", `Staffel (\d+) Folge (\d+)`, "Staffel 2 Folge 7", "Staffel 2 Folge 7", "S02E07"},
+		{"three groups", `S(\d+)E(\d+)(?:-(\d+))?`, "S01E04-05", "S01E04-05", "S01E04E05"},
+		{"three groups, third unused", `S(\d+)E(\d+)(?:-(\d+))?`, "S01E06", "S01E06", "S01E06"},
+		{"no match", `S(\d+)E(\d+)`, "Trailer", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadRules(t, "[[site]]\ndomains = [\"example.com\"]\nrow = \".ep\"\nid = \".id\"\nid_regex = '"+tt.idRegex+"'\nlink = \"a\"\n")
+			result, err := p.Apply(`<div class="ep"><span class="id">` + tt.text + `</span><a href="/e.mp4">Download</a></div>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(result.Rows))
+			}
+			if row := result.Rows[0]; row.RawID != tt.rawID || row.ID != tt.id {
+				t.Errorf("got ID %q from %q, want %q from %q", row.ID, row.RawID, tt.id, tt.rawID)
+			}
+		})
+	}
+}
+
+func TestRulesSelectorAndRegex(t *testing.T) {
+	body := readFixture(t, "series_basic.html")
+	tests := []struct {
+		name  string
+		rules string
+		check func(t *testing.T, result *RuleResult)
+	}{
+		{
+			// The regex is applied to the text of the selected elements,
+			// once each, and a single group is taken
+			name: "selector and regex",
+			rules: `title = "h1"
+title_regex = '^(.+?) &'
+season = "h3"
+row = ".cell_row"
+id = ".cell2"
+size = ".cell3"
+size_regex = '(\d+) Mb'
+link = ".cell4 a"
+link_regex = 'dl2\..*'`,
+			check: func(t *testing.T, result *RuleResult) {
+				if result.Title != "Example Show" {
+					t.Errorf("Title = %q", result.Title)
+				}
+				// The default season regex takes the number
+				if !reflect.DeepEqual(result.Seasons, []string{"1", "2"}) {
+					t.Errorf("Seasons = %q", result.Seasons)
+				}
+				if result.Rows[0].Size != "245" {
+					t.Errorf("Size = %q, want 245", result.Rows[0].Size)
+				}
+				var links []string
+				for _, row := range result.Rows {
+					links = append(links, row.Links...)
+				}
+				if !reflect.DeepEqual(links, []string{"dl2.example.net/Example.Show.S01E01.480p.mp4"}) {
+					t.Errorf("links = %q", links)
+				}
+			},
+		},
+		{
+			// A regex alone is applied to the HTML and takes every match
+			name: "regex only",
+			rules: `title_regex = '<title>(.+?) - '
+season_regex = 'Season (\d+)'
+row_regex = '(?s)<div class="cell_row">.*?</a></div></div>'
+id_regex = '(?i)S(\d+)E(\d+)'
+link_regex = 'href="([^"]+\.mp4)"'`,
+			check: func(t *testing.T, result *RuleResult) {
+				if result.Title != "Example Show" {
+					t.Errorf("Title = %q", result.Title)
+				}
+				if !reflect.DeepEqual(result.Seasons, []string{"1", "2"}) {
+					t.Errorf("Seasons = %q", result.Seasons)
+				}
+				var ids []string
+				for _, row := range result.Rows {
+					ids = append(ids, row.ID)
+				}
+				if want := []string{"S01E01", "S01E01", "S01E02", "S01E03", "S02E01", "S02E02"}; !reflect.DeepEqual(ids, want) {
+					t.Errorf("IDs = %q, want %q", ids, want)
+				}
+				if want := []string{"https://dl2.example.net/Example.Show.S01E01.480p.mp4"}; !reflect.DeepEqual(result.Rows[1].Links, want) {
+					t.Errorf("mirror links = %q, want %q", result.Rows[1].Links, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadRules(t, "[[site]]\ndomains = [\"example.com\"]\n"+tt.rules+"\n")
+			result, err := p.Apply(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Rows) != 6 {
+				t.Fatalf("got %d rows, want 6", len(result.Rows))
+			}
+			tt.check(t, result)
+		})
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	site := func(skip string) string {
+		var lines []string
+		for _, line := range []string{`name = "test"`, `domains = ["example.com"]`, `row = ".ep"`, `id = ".id"`, `link = "a"`} {
+			if !strings.HasPrefix(line, skip+" ") {
+				lines = append(lines, line)
+			}
+		}
+		return "[[site]]\n" + strings.Join(lines, "\n") + "\n"
+	}
+
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"no row", site("row"), "site test: row needs a selector or a regex"},
+		{"no id", site("id"), "site test: id needs a selector or a regex"},
+		{"no link", site("link"), "site test: link needs a selector or a regex"},
+		{"no domains", site("domains"), "site test: no domains"},
+		{"unnamed site", "[[site]]\nrow = \".ep\"\n", "site #1: no domains"},
+		{"bad selector", site("") + "size = \"div[\"\n", "site test: size selector: "},
+		{"bad regex", site("") + "size_regex = '(\\d+'\n", "site test: size regex: "},
+		{"unknown setting", site("") + "rows = \".ep\"\n", `unknown setting "site.rows"`},
+		{"no sites", "# nothing yet\n", "no [[site]] rules"},
+		{"not TOML", "[[site]\n", "failed to read rules: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.toml")
+			if err := os.WriteFile(path, []byte(tt.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadRules(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadRules(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
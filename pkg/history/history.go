@@ -0,0 +1,197 @@
+// Package history remembers every finished download, so a file is not
+// downloaded again after it was moved out of the download folder
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tt6d/pkg/datafile"
+)
+
+// historyVersion is bumped when the file format changes incompatibly
+const historyVersion = 1
+
+// Entry is one finished download
+type Entry struct {
+	Series    string `json:"series,omitempty"`
+	EpisodeID string `json:"episode_id,omitempty"`
+	// URL is the link the file was found as on the page
+	URL    string    `json:"url"`
+	Page   string    `json:"page,omitempty"`
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Time   time.Time `json:"time"`
+}
+
+// DB is the download history, kept in a single JSON file. A nil *DB is
+// valid, remembers nothing and records nothing.
+type DB struct {
+	mu      sync.Mutex
+	path    string
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// DefaultPath returns history.json in the tt6d data folder
+// (~/.local/share/tt6d unless XDG_DATA_HOME is set)
+func DefaultPath() string {
+	return datafile.Path("history.json")
+}
+
+// Open loads the history, or starts an empty one if there is none
+func Open(path string) (*DB, error) {
+	db := &DB{path: path, Version: historyVersion}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) load() error {
+	data, err := os.ReadFile(db.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+
+	var file DB
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse history %s: %v", db.path, err)
+	}
+	if file.Version != historyVersion {
+		return fmt.Errorf("unsupported history version %d in %s", file.Version, db.path)
+	}
+	db.Entries = file.Entries
+	return nil
+}
+
+// Record adds a finished download at e.Path, filling in its size, hash and
+// time. The file is hashed before the history is locked, then the history is
+// read again so entries written by another tt6d are kept.
+func (db *DB) Record(e Entry) error {
+	if db == nil {
+		return nil
+	}
+	size, sum, err := hashFile(e.Path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %v", e.Path, err)
+	}
+	if abs, err := filepath.Abs(e.Path); err == nil {
+		e.Path = abs
+	}
+	e.Size, e.SHA256, e.Time = size, sum, time.Now()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	unlock, err := datafile.Lock(db.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := db.load(); err != nil {
+		return err
+	}
+	db.Entries = append(db.Entries, e)
+	return db.save()
+}
+
+// Episode returns the latest download of an episode of a series, matching
+// the title without regard to case
+func (db *DB) Episode(series, episodeID string) (Entry, bool) {
+	return db.last(func(e Entry) bool {
+		return e.EpisodeID != "" && e.EpisodeID == episodeID && strings.EqualFold(e.Series, series)
+	})
+}
+
+// Link returns the latest download of a link
+func (db *DB) Link(link string) (Entry, bool) {
+	return db.last(func(e Entry) bool {
+		return e.URL == link
+	})
+}
+
+func (db *DB) last(match func(Entry) bool) (Entry, bool) {
+	if db == nil {
+		return Entry{}, false
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := len(db.Entries) - 1; i >= 0; i-- {
+		if match(db.Entries[i]) {
+			return db.Entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Filter selects history entries. Empty fields match everything.
+type Filter struct {
+	// Series and URL match any part, without regard to case
+	Series  string
+	URL     string
+	Episode string
+	Since   time.Time
+}
+
+// Find returns the entries that match the filter, oldest first
+func (db *DB) Find(f Filter) []Entry {
+	if db == nil {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var entries []Entry
+	for _, e := range db.Entries {
+		switch {
+		case f.Series != "" && !containsFold(e.Series, f.Series):
+		case f.URL != "" && !containsFold(e.URL, f.URL) && !containsFold(e.Page, f.URL):
+		case f.Episode != "" && !strings.EqualFold(e.EpisodeID, f.Episode):
+		case e.Time.Before(f.Since):
+		default:
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (db *DB) save() error {
+	if err := datafile.WriteJSON(db.path, db); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	return nil
+}
+
+// hashFile returns the size and SHA-256 of a file
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,53 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "S01E02.mp4")
+	if err := os.WriteFile(filePath, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "history.json")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := Entry{Series: "Show", EpisodeID: "S01E02", URL: "https://example.com/2.mp4", Path: filePath}
+	if err := first.Record(entry); err != nil {
+		t.Fatal(err)
+	}
+	// Another tt6d records a download into the same history
+	if err := second.Record(Entry{URL: "https://example.com/other.mp4", Path: filePath}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Entries) != 2 {
+		t.Fatalf("history has %d entries, want both", len(db.Entries))
+	}
+	got, ok := db.Episode("show", "S01E02")
+	if !ok {
+		t.Fatal("episode not found")
+	}
+	// sha256 of "video"
+	const sum = "0cab1c9617404faf2b24e221e189ca5945813e14d3f766345b09ca13bbe28ffc"
+	if got.Size != 5 || got.SHA256 != sum || got.Path != filePath || got.Time.IsZero() {
+		t.Errorf("recorded %+v", got)
+	}
+	if _, ok := db.Link("https://example.com/other.mp4"); !ok {
+		t.Error("entry of the other tt6d was lost")
+	}
+}
@@ -0,0 +1,314 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fetcher opens a URL for reading. The downloader supplies one with stall
+// detection and rate limiting.
+type Fetcher func(ctx context.Context, url string) (io.ReadCloser, error)
+
+// DefaultFetcher is a plain HTTP GET
+func DefaultFetcher(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned status code: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// IsPlaylistURL reports whether a link looks like an HLS playlist
+func IsPlaylistURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// Load fetches and parses a playlist
+func Load(ctx context.Context, fetch Fetcher, playlistURL string) (*Playlist, error) {
+	if fetch == nil {
+		fetch = DefaultFetcher
+	}
+
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL: %v", err)
+	}
+
+	body, err := fetch(ctx, playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+	defer body.Close()
+
+	return Parse(body, base)
+}
+
+// SelectVariant picks a variant by quality: "best" or "" (highest bandwidth),
+// "worst", a height such as "720p" (closest at or below), or a bandwidth in
+// bits per second (closest at or below).
+func SelectVariant(variants []Variant, quality string) (Variant, error) {
+	if len(variants) == 0 {
+		return Variant{}, fmt.Errorf("no variants to choose from")
+	}
+
+	sorted := append([]Variant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Bandwidth < sorted[j].Bandwidth
+	})
+
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	switch quality {
+	case "", "best":
+		return sorted[len(sorted)-1], nil
+	case "worst":
+		return sorted[0], nil
+	}
+
+	target, byHeight, err := parseQuality(quality)
+	if err != nil {
+		return Variant{}, err
+	}
+
+	// Highest variant that does not exceed the target, or the lowest one
+	chosen := sorted[0]
+	for _, v := range sorted {
+		value := v.Bandwidth
+		if byHeight {
+			value = int64(v.Height)
+		}
+		if value <= target {
+			chosen = v
+		}
+	}
+	return chosen, nil
+}
+
+// ValidateQuality checks a quality string accepted by SelectVariant
+func ValidateQuality(quality string) error {
+	switch strings.ToLower(strings.TrimSpace(quality)) {
+	case "", "best", "worst":
+		return nil
+	}
+	_, _, err := parseQuality(quality)
+	return err
+}
+
+// parseQuality reads "720p" as a height or "1500000" as a bandwidth
+func parseQuality(quality string) (target int64, byHeight bool, err error) {
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	byHeight = strings.HasSuffix(quality, "p")
+	target, err = strconv.ParseInt(strings.TrimSuffix(quality, "p"), 10, 64)
+	if err != nil || target <= 0 {
+		return 0, false, fmt.Errorf("invalid quality %q (use best, worst, 720p or a bandwidth)", quality)
+	}
+	return target, byHeight, nil
+}
+
+// Options controls how segments are downloaded
+type Options struct {
+	// Concurrency is the number of segments fetched at the same time
+	Concurrency int
+	// Fetch opens segment and key URLs (defaults to DefaultFetcher)
+	Fetch Fetcher
+	// Start is the index of the first segment to fetch, for resuming
+	Start int
+	// OnSegment is called after segment index has been written, with the
+	// number of bytes it added
+	OnSegment func(index int, written int64)
+}
+
+// Download fetches the segments of a media playlist concurrently, decrypts
+// them and writes them to w in playlist order, producing a single stream
+func Download(ctx context.Context, playlist *Playlist, w io.Writer, opts Options) error {
+	if playlist.IsMaster() {
+		return fmt.Errorf("master playlist given; select a variant first")
+	}
+	if opts.Fetch == nil {
+		opts.Fetch = DefaultFetcher
+	}
+
+	keys := &keyCache{fetch: opts.Fetch, keys: make(map[string][]byte)}
+
+	if playlist.Init != nil && opts.Start == 0 {
+		data, err := fetchSegment(ctx, opts.Fetch, keys, *playlist.Init)
+		if err != nil {
+			return fmt.Errorf("init section: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write init section: %v", err)
+		}
+	}
+
+	segments := playlist.Segments
+	fetch := func(ctx context.Context, i int) ([]byte, error) {
+		return fetchSegment(ctx, opts.Fetch, keys, segments[i])
+	}
+	return FetchSegments(ctx, opts.Start, len(segments), opts.Concurrency, fetch, func(i int, data []byte) error {
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write segment %d: %v", i+1, err)
+		}
+		if opts.OnSegment != nil {
+			opts.OnSegment(i, int64(len(data)))
+		}
+		return nil
+	})
+}
+
+// FetchSegments fetches segments start to count-1 with up to concurrency
+// requests at a time and hands each to write in order. Fetching runs ahead
+// of writing, bounded so memory use stays small. The first error stops it.
+func FetchSegments(ctx context.Context, start, count, concurrency int, fetch func(ctx context.Context, index int) ([]byte, error), write func(index int, data []byte) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan result, count)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	slots := make(chan struct{}, concurrency)
+	go func() {
+		for i := start; i < count; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int) {
+				data, err := fetch(ctx, i)
+				results[i] <- result{data: data, err: err}
+			}(i)
+		}
+	}()
+
+	for i := start; i < count; i++ {
+		var r result
+		select {
+		case r = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-slots
+
+		if r.err != nil {
+			return fmt.Errorf("segment %d: %w", i+1, r.err)
+		}
+		if err := write(i, r.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchSegment downloads and, if needed, decrypts one segment
+func fetchSegment(ctx context.Context, fetch Fetcher, keys *keyCache, seg Segment) ([]byte, error) {
+	body, err := fetch(ctx, seg.URI)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if seg.Key == nil {
+		return data, nil
+	}
+
+	key, err := keys.get(ctx, seg.Key.URI)
+	if err != nil {
+		return nil, err
+	}
+	iv := seg.Key.IV
+	if iv == nil {
+		// Without an explicit IV the media sequence number is used
+		iv = make([]byte, 16)
+		binary.BigEndian.PutUint64(iv[8:], uint64(seg.Sequence))
+	}
+	return decryptAES128(data, key, iv)
+}
+
+// decryptAES128 decrypts AES-128-CBC data with PKCS#7 padding
+func decryptAES128(data, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment has invalid length %d", len(data))
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid padding, wrong key?")
+	}
+	return out[:len(out)-padding], nil
+}
+
+// keyCache fetches each key URI only once
+type keyCache struct {
+	mu    sync.Mutex
+	fetch Fetcher
+	keys  map[string][]byte
+}
+
+func (c *keyCache) get(ctx context.Context, uri string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[uri]; ok {
+		return key, nil
+	}
+
+	body, err := c.fetch(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	defer body.Close()
+
+	key, err := io.ReadAll(io.LimitReader(body, 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("key has %d bytes, expected 16", len(key))
+	}
+	c.keys[uri] = key
+	return key, nil
+}
@@ -0,0 +1,228 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testKey = []byte("0123456789abcdef")
+	testIV  = []byte("fedcba9876543210")
+)
+
+// encryptAES128 is the inverse of decryptAES128, padding with PKCS#7
+func encryptAES128(t *testing.T, plain, key, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data
+}
+
+// encryptRaw encrypts whole blocks without adding padding
+func encryptRaw(t *testing.T, data, key, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+func TestDecryptAES128RoundTrip(t *testing.T) {
+	// Lengths around the block size, including an exact multiple that gets
+	// a whole block of padding
+	for _, n := range []int{0, 1, 15, 16, 17, 31, 32, 188 * 7} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			plain := bytes.Repeat([]byte{0x47}, n)
+			data := encryptAES128(t, plain, testKey, testIV)
+			if want := (n/aes.BlockSize + 1) * aes.BlockSize; len(data) != want {
+				t.Fatalf("encrypted %d bytes to %d, want %d", n, len(data), want)
+			}
+			got, err := decryptAES128(data, testKey, testIV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decrypted %d bytes, want the %d plain ones", len(got), n)
+			}
+		})
+	}
+}
+
+func TestDecryptAES128Errors(t *testing.T) {
+	block := func(last ...byte) []byte {
+		return append(bytes.Repeat([]byte{'x'}, aes.BlockSize-len(last)), last...)
+	}
+	otherKey := []byte("fedcba9876543210")
+
+	tests := []struct {
+		name string
+		data []byte
+		key  []byte
+		want string
+	}{
+		{"empty", nil, testKey, "encrypted segment has invalid length 0"},
+		{"partial block", make([]byte, 20), testKey, "encrypted segment has invalid length 20"},
+		{"short key", make([]byte, 16), testKey[:10], "invalid key: crypto/aes: invalid key size 10"},
+		{"zero padding", encryptRaw(t, block(0), testKey, testIV), testKey, "invalid padding, wrong key?"},
+		{"padding over a block", encryptRaw(t, block(17), testKey, testIV), testKey, "invalid padding, wrong key?"},
+		{"uneven padding", encryptRaw(t, block(3, 2, 3), testKey, testIV), testKey, "invalid padding, wrong key?"},
+		{"wrong key", encryptAES128(t, []byte("segment"), otherKey, testIV), testKey, "invalid padding, wrong key?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptAES128(tt.data, tt.key, testIV)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// fakeServer is a Fetcher serving fixed bodies that counts requests
+type fakeServer struct {
+	mu       sync.Mutex
+	bodies   map[string][]byte
+	requests map[string]int
+}
+
+func newFakeServer(bodies map[string][]byte) *fakeServer {
+	return &fakeServer{bodies: bodies, requests: make(map[string]int)}
+}
+
+func (s *fakeServer) fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[url]++
+	body, ok := s.bodies[url]
+	if !ok {
+		return nil, fmt.Errorf("server returned status code: 404")
+	}
+	return io.NopCloser(bytes.NewReader(body)), nil
+}
+
+func sequenceIV(sequence uint64) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+	return iv
+}
+
+func TestFetchSegmentIV(t *testing.T) {
+	plain := []byte("transport stream packets")
+	tests := []struct {
+		name     string
+		sequence int64
+		iv       []byte
+		encIV    []byte
+	}{
+		{"from the sequence number", 41, nil, sequenceIV(41)},
+		{"large sequence number", 1 << 40, nil, sequenceIV(1 << 40)},
+		{"first segment", 0, nil, make([]byte, 16)},
+		{"explicit", 41, testIV, testIV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(map[string][]byte{
+				"https://example.com/key": testKey,
+				"https://example.com/seg": encryptAES128(t, plain, testKey, tt.encIV),
+			})
+			keys := &keyCache{fetch: server.fetch, keys: make(map[string][]byte)}
+			seg := Segment{URI: "https://example.com/seg", Sequence: tt.sequence, Key: &Key{Method: "AES-128", URI: "https://example.com/key", IV: tt.iv}}
+			got, err := fetchSegment(context.Background(), server.fetch, keys, seg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("got %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+	playlist := parseFixture(t, "media.m3u8")
+	base := "https://cdn.example.com/show/hls/"
+	k2IV := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	server := newFakeServer(map[string][]byte{
+		base + "init.mp4":                         []byte("[init]"),
+		base + "seg41.m4s":                        []byte("[41]"),
+		base + "keys/k1.bin":                      testKey,
+		base + "seg42.m4s":                        encryptAES128(t, []byte("[42]"), testKey, sequenceIV(42)),
+		"https://cdn.example.com/media/seg43.m4s": encryptAES128(t, []byte("[43]"), testKey, sequenceIV(43)),
+		"https://keys.example.com/k2":             []byte("0000000000000002"),
+		base + "seg44.m4s":                        encryptAES128(t, []byte("[44]"), []byte("0000000000000002"), k2IV),
+		base + "seg45.m4s":                        []byte("[45]"),
+	})
+
+	tests := []struct {
+		start int
+		want  string
+	}{
+		{0, "[init][41][42][43][44][45]"},
+		// Resuming skips the init section, which is already written
+		{3, "[44][45]"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.start), func(t *testing.T) {
+			var out bytes.Buffer
+			var written []string
+			err := Download(context.Background(), playlist, &out, Options{
+				Concurrency: 3,
+				Fetch:       server.fetch,
+				Start:       tt.start,
+				OnSegment: func(index int, n int64) {
+					written = append(written, fmt.Sprintf("%d:%d", index, n))
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("wrote %q, want %q", out.String(), tt.want)
+			}
+			if len(written) != len(playlist.Segments)-tt.start || written[0] != fmt.Sprintf("%d:4", tt.start) {
+				t.Errorf("OnSegment calls %v", written)
+			}
+		})
+	}
+	if n := server.requests[base+"keys/k1.bin"]; n != 1 {
+		t.Errorf("key fetched %d times in the first run, want once", n)
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	playlist := parseFixture(t, "media.m3u8")
+	server := newFakeServer(map[string][]byte{
+		"https://cdn.example.com/show/hls/init.mp4":  []byte("[init]"),
+		"https://cdn.example.com/show/hls/seg41.m4s": []byte("[41]"),
+	})
+
+	var out bytes.Buffer
+	err := Download(context.Background(), playlist, &out, Options{Fetch: server.fetch})
+	if err == nil || !strings.HasPrefix(err.Error(), "segment 2: ") {
+		t.Errorf("got error %v, want one for segment 2", err)
+	}
+	if out.String() != "[init][41]" {
+		t.Errorf("wrote %q before the error", out.String())
+	}
+
+	master := parseFixture(t, "master.m3u8")
+	if err := Download(context.Background(), master, &out, Options{}); err == nil {
+		t.Error("downloading a master playlist gave no error")
+	}
+}
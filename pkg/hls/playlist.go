@@ -0,0 +1,231 @@
+package hls
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Playlist is either a master playlist (Variants) or a media playlist (Segments)
+type Playlist struct {
+	Variants []Variant
+	Segments []Segment
+	// Init is the EXT-X-MAP initialization section, if any
+	Init *Segment
+}
+
+// IsMaster reports whether the playlist lists variant streams
+func (p *Playlist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// Variant is one quality level of a master playlist
+type Variant struct {
+	URI       string
+	Bandwidth int64
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+// String describes the variant for display
+func (v Variant) String() string {
+	s := fmt.Sprintf("%.0f kbps", float64(v.Bandwidth)/1000)
+	if v.Height > 0 {
+		s = fmt.Sprintf("%dx%d, %s", v.Width, v.Height, s)
+	}
+	if v.Codecs != "" {
+		s += " (" + v.Codecs + ")"
+	}
+	return s
+}
+
+// Segment is one media segment of a media playlist
+type Segment struct {
+	URI      string
+	Duration float64
+	Sequence int64
+	Key      *Key
+}
+
+// Key describes how a segment is encrypted
+type Key struct {
+	Method string // NONE or AES-128
+	URI    string
+	IV     []byte // nil means derive from the sequence number
+}
+
+// Parse reads an M3U8 playlist. Relative URIs are resolved against base.
+func Parse(r io.Reader, base *url.URL) (*Playlist, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !scanner.Scan() || strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF")) != "#EXTM3U" {
+		return nil, fmt.Errorf("not an M3U8 playlist")
+	}
+
+	playlist := &Playlist{}
+	var (
+		sequence      int64
+		key           *Key
+		duration      float64
+		pendingStream map[string]string
+	)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			pendingStream = parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			n, err := strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid media sequence: %q", line)
+			}
+			sequence = n
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			k, err := parseKey(attrs, base)
+			if err != nil {
+				return nil, err
+			}
+			key = k
+
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))
+			uri, err := resolve(base, attrs["URI"])
+			if err != nil {
+				return nil, err
+			}
+			playlist.Init = &Segment{URI: uri, Key: key}
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration: %q", line)
+			}
+			duration = d
+
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments are not needed for downloading
+
+		default:
+			uri, err := resolve(base, line)
+			if err != nil {
+				return nil, err
+			}
+			if pendingStream != nil {
+				playlist.Variants = append(playlist.Variants, newVariant(uri, pendingStream))
+				pendingStream = nil
+				continue
+			}
+			playlist.Segments = append(playlist.Segments, Segment{
+				URI:      uri,
+				Duration: duration,
+				Sequence: sequence,
+				Key:      key,
+			})
+			sequence++
+			duration = 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %v", err)
+	}
+	if len(playlist.Variants) == 0 && len(playlist.Segments) == 0 {
+		return nil, fmt.Errorf("playlist has no variants or segments")
+	}
+	return playlist, nil
+}
+
+func newVariant(uri string, attrs map[string]string) Variant {
+	v := Variant{URI: uri, Codecs: attrs["CODECS"]}
+	v.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+	if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+		v.Width, _ = strconv.Atoi(w)
+		v.Height, _ = strconv.Atoi(h)
+	}
+	return v
+}
+
+func parseKey(attrs map[string]string, base *url.URL) (*Key, error) {
+	method := attrs["METHOD"]
+	switch method {
+	case "NONE":
+		return nil, nil
+	case "AES-128":
+	default:
+		return nil, fmt.Errorf("unsupported encryption method %q", method)
+	}
+
+	uri, err := resolve(base, attrs["URI"])
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{Method: method, URI: uri}
+
+	if iv := attrs["IV"]; iv != "" {
+		iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+		b, err := hex.DecodeString(iv)
+		if err != nil || len(b) != 16 {
+			return nil, fmt.Errorf("invalid key IV %q", attrs["IV"])
+		}
+		key.IV = b
+	}
+	return key, nil
+}
+
+// parseAttributes parses an attribute list such as
+// BANDWIDTH=1280000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+	for list != "" {
+		name, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attrs[strings.TrimSpace(name)] = value
+		list = rest
+	}
+	return attrs
+}
+
+func resolve(base *url.URL, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("playlist entry without URI")
+	}
+	if base == nil {
+		return ref, nil
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid playlist URI %q: %v", ref, err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,172 @@
+package hls
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// playlistURL is where the fixtures are pretended to come from
+var playlistURL, _ = url.Parse("https://cdn.example.com/show/hls/index.m3u8")
+
+func parseFixture(t *testing.T, name string) *Playlist {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist, err := Parse(bytes.NewReader(data), playlistURL)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return playlist
+}
+
+func TestParseMaster(t *testing.T) {
+	playlist := parseFixture(t, "master.m3u8")
+	if !playlist.IsMaster() {
+		t.Fatal("master playlist is not a master")
+	}
+	want := []Variant{
+		{URI: "https://cdn.example.com/show/hls/360p/index.m3u8", Bandwidth: 800000, Width: 640, Height: 360, Codecs: "avc1.4d401e,mp4a.40.2"},
+		{URI: "https://cdn.example.com/show/hd/720p.m3u8?token=abc", Bandwidth: 2800000, Width: 1280, Height: 720, Codecs: "avc1.4d401f,mp4a.40.2"},
+		{URI: "https://other.example.com/1080p.m3u8", Bandwidth: 5000000, Width: 1920, Height: 1080},
+		{URI: "https://cdn.example.com/audio/only.m3u8", Bandwidth: 64000, Codecs: "mp4a.40.2"},
+	}
+	if !reflect.DeepEqual(playlist.Variants, want) {
+		t.Errorf("Variants:\ngot  %+v\nwant %+v", playlist.Variants, want)
+	}
+	if len(playlist.Segments) != 0 || playlist.Init != nil {
+		t.Errorf("master playlist has segments %v and init %v", playlist.Segments, playlist.Init)
+	}
+}
+
+func TestParseMedia(t *testing.T) {
+	playlist := parseFixture(t, "media.m3u8")
+	if playlist.IsMaster() {
+		t.Fatal("media playlist is a master")
+	}
+
+	first := &Key{Method: "AES-128", URI: "https://cdn.example.com/show/hls/keys/k1.bin"}
+	second := &Key{Method: "AES-128", URI: "https://keys.example.com/k2", IV: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}}
+	want := []Segment{
+		{URI: "https://cdn.example.com/show/hls/seg41.m4s", Duration: 6, Sequence: 41},
+		{URI: "https://cdn.example.com/show/hls/seg42.m4s", Duration: 6, Sequence: 42, Key: first},
+		{URI: "https://cdn.example.com/media/seg43.m4s", Duration: 5.5, Sequence: 43, Key: first},
+		{URI: "https://cdn.example.com/show/hls/seg44.m4s", Duration: 4, Sequence: 44, Key: second},
+		{URI: "https://cdn.example.com/show/hls/seg45.m4s", Duration: 2.25, Sequence: 45},
+	}
+	if !reflect.DeepEqual(playlist.Segments, want) {
+		t.Errorf("Segments:\ngot  %+v\nwant %+v", playlist.Segments, want)
+	}
+	if playlist.Segments[1].Key != playlist.Segments[2].Key {
+		t.Error("segments under one EXT-X-KEY do not share it")
+	}
+
+	// The map comes before any key, so it is not encrypted
+	wantInit := &Segment{URI: "https://cdn.example.com/show/hls/init.mp4"}
+	if !reflect.DeepEqual(playlist.Init, wantInit) {
+		t.Errorf("Init = %+v, want %+v", playlist.Init, wantInit)
+	}
+}
+
+func TestParseWithoutBase(t *testing.T) {
+	playlist, err := Parse(strings.NewReader("#EXTM3U\n#EXTINF:3,\n../seg1.ts\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := playlist.Segments[0].URI; got != "../seg1.ts" {
+		t.Errorf("URI = %q, want it unchanged", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{"not a playlist", "<html></html>", "not an M3U8 playlist"},
+		{"empty", "", "not an M3U8 playlist"},
+		{"no entries", "#EXTM3U\n#EXT-X-ENDLIST\n", "playlist has no variants or segments"},
+		{"bad sequence", "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:x\n", `invalid media sequence: "#EXT-X-MEDIA-SEQUENCE:x"`},
+		{"bad duration", "#EXTM3U\n#EXTINF:long,\nseg.ts\n", `invalid segment duration: "#EXTINF:long,"`},
+		{"SAMPLE-AES", "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n", `unsupported encryption method "SAMPLE-AES"`},
+		{"key without URI", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128\n", "playlist entry without URI"},
+		{"short IV", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x0102\n", `invalid key IV "0x0102"`},
+		{"map without URI", "#EXTM3U\n#EXT-X-MAP:BYTERANGE=\"100@0\"\n", "playlist entry without URI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.playlist), playlistURL)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,NAME="unterminated`)
+	want := map[string]string{
+		"BANDWIDTH":  "1280000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"NAME":       "unterminated",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := parseFixture(t, "master.m3u8").Variants
+
+	tests := []struct {
+		quality string
+		want    int64
+	}{
+		{"", 5000000},
+		{"best", 5000000},
+		{" BEST ", 5000000},
+		{"worst", 64000},
+		{"720p", 2800000},
+		{"1000p", 2800000},
+		{"1080P", 5000000},
+		// Lower than all, so the lowest, which is the audio-only variant
+		{"240p", 64000},
+		{"3000000", 2800000},
+		{"800000", 800000},
+		{"1", 64000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.quality, func(t *testing.T) {
+			got, err := SelectVariant(variants, tt.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bandwidth != tt.want {
+				t.Errorf("chose %v, want the %d bps variant", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectVariantErrors(t *testing.T) {
+	if _, err := SelectVariant(nil, "best"); err == nil {
+		t.Error("no error without variants")
+	}
+	variants := []Variant{{Bandwidth: 1}}
+	for _, quality := range []string{"hd", "0p", "-5", "p"} {
+		if _, err := SelectVariant(variants, quality); err == nil {
+			t.Errorf("SelectVariant(%q) gave no error", quality)
+		}
+		if err := ValidateQuality(quality); err == nil {
+			t.Errorf("ValidateQuality(%q) gave no error", quality)
+		}
+	}
+}
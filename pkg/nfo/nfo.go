@@ -0,0 +1,57 @@
+package nfo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+// header is the XML declaration Kodi and Jellyfin expect at the top of an NFO
+const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>` + "\n"
+
+// TVShow is the series level metadata written to tvshow.nfo
+type TVShow struct {
+	XMLName xml.Name `xml:"tvshow"`
+	Title   string   `xml:"title"`
+	Plot    string   `xml:"plot,omitempty"`
+	Thumb   string   `xml:"thumb,omitempty"` // poster filename or URL
+}
+
+// Episode is the metadata written next to each episode file
+type Episode struct {
+	XMLName   xml.Name `xml:"episodedetails"`
+	Title     string   `xml:"title"`
+	ShowTitle string   `xml:"showtitle"`
+	Season    int      `xml:"season"`
+	Episode   int      `xml:"episode"`
+}
+
+// Write encodes an NFO document (TVShow or Episode) to w
+func Write(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode NFO: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile writes an NFO document to the given path
+func WriteFile(path string, doc interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create NFO file: %v", err)
+	}
+
+	if err := Write(f, doc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
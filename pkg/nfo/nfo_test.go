@@ -0,0 +1,93 @@
+package nfo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  interface{}
+		want string
+	}{
+		{
+			name: "tvshow",
+			doc:  TVShow{Title: "Tom & Jerry", Plot: "A cat chases a mouse.", Thumb: "poster.jpg"},
+			want: `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<tvshow>
+  <title>Tom &amp; Jerry</title>
+  <plot>A cat chases a mouse.</plot>
+  <thumb>poster.jpg</thumb>
+</tvshow>
+`,
+		},
+		{
+			name: "tvshow without optional fields",
+			doc:  TVShow{Title: "Dark"},
+			want: `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<tvshow>
+  <title>Dark</title>
+</tvshow>
+`,
+		},
+		{
+			name: "episode",
+			doc:  Episode{Title: "Secrets", ShowTitle: "Dark", Season: 1, Episode: 2},
+			want: `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<episodedetails>
+  <title>Secrets</title>
+  <showtitle>Dark</showtitle>
+  <season>1</season>
+  <episode>2</episode>
+</episodedetails>
+`,
+		},
+		{
+			name: "special",
+			doc:  Episode{Title: "S00E01", ShowTitle: "Dark <Extended>", Season: 0, Episode: 1},
+			want: `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<episodedetails>
+  <title>S00E01</title>
+  <showtitle>Dark &lt;Extended&gt;</showtitle>
+  <season>0</season>
+  <episode>1</episode>
+</episodedetails>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tt.doc); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tvshow.nfo")
+	if err := WriteFile(path, TVShow{Title: "Dark"}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	Write(&want, TVShow{Title: "Dark"})
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("file holds\n%s\nwant\n%s", got, want.Bytes())
+	}
+
+	if err := WriteFile(filepath.Join(t.TempDir(), "missing", "tvshow.nfo"), TVShow{}); err == nil {
+		t.Error("WriteFile into a missing folder succeeded")
+	}
+}
@@ -3,19 +3,38 @@ package progress
 import (
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
-// Writer wraps an io.Writer and tracks progress
+// Interactive reports whether progress bars are drawn in place on a
+// terminal. Otherwise, such as when output goes to a log file, only
+// finished downloads and status messages are printed, one line each.
+var Interactive = isTerminal(os.Stdout)
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Writer wraps an io.Writer and tracks progress.
+// It is safe for concurrent use, so several connections can share one bar.
 type Writer struct {
+	mu         sync.Mutex
 	writer     io.Writer
 	total      int64
 	written    int64
 	filename   string
 	index      int
 	totalFiles int
+	attempt    int
+	attempts   int
+	segments   int // total segments for segmented streams such as HLS
+	segsDone   int
+	done       bool
 	lastUpdate time.Time
 }
 
@@ -31,16 +50,58 @@ func New(writer io.Writer, total int64, filename string, index, totalFiles int)
 	}
 }
 
+// SetOffset marks n bytes as already written, e.g. when resuming a download
+func (pw *Writer) SetOffset(n int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.written = n
+}
+
+// SetAttempt records which retry attempt this is, shown when attempt > 1
+func (pw *Writer) SetAttempt(attempt, attempts int) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.attempt = attempt
+	pw.attempts = attempts
+}
+
+// SetSegments reports progress in segments, for streams whose total size is
+// unknown up front. The display is refreshed immediately.
+func (pw *Writer) SetSegments(done, total int) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.segsDone = done
+	pw.segments = total
+	pw.displayProgress()
+	pw.lastUpdate = time.Now()
+}
+
+// Done marks the download as finished and shows it. Completion comes from
+// the download rather than the byte count, since the size of some files is
+// unknown and others still fail checks after the last byte.
+func (pw *Writer) Done() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.done {
+		return
+	}
+	pw.done = true
+	pw.displayProgress()
+	pw.lastUpdate = time.Now()
+}
+
 func (pw *Writer) Write(p []byte) (int, error) {
 	n, err := pw.writer.Write(p)
 	if err != nil {
 		return n, err
 	}
 
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
 	pw.written += int64(n)
 
 	// Update progress bar every 100ms to avoid too frequent updates
-	if time.Since(pw.lastUpdate) >= 100*time.Millisecond || pw.written == pw.total {
+	if time.Since(pw.lastUpdate) >= 100*time.Millisecond || (pw.segments == 0 && pw.written == pw.total) {
 		pw.displayProgress()
 		pw.lastUpdate = time.Now()
 	}
@@ -57,6 +118,13 @@ func (pw *Writer) displayProgress() {
 	if pw.total == 0 {
 		percentage = 0
 	}
+	if pw.segments > 0 {
+		percentage = float64(pw.segsDone) / float64(pw.segments) * 100
+	}
+	complete := pw.done
+	if complete {
+		percentage = 100
+	}
 
 	// Create progress bar
 	barWidth := 30
@@ -71,12 +139,27 @@ func (pw *Writer) displayProgress() {
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if !Interactive {
+		if complete {
+			fmt.Printf("[%d/%d] %s ✓ (%.1f MB)\n", pw.index, pw.totalFiles, pw.filename, writtenMB)
+		}
+		return
+	}
+
 	// Move cursor to the correct line based on the worker index
-	fmt.Printf("\033[%d;0H\033[K[%d/%d] %s [%s] %.1f%% (%.1f/%.1f MB)",
-		pw.index, pw.index, pw.totalFiles, pw.filename, bar, percentage, writtenMB, totalMB)
+	if pw.segments > 0 {
+		fmt.Printf("\033[%d;0H\033[K[%d/%d] %s [%s] %.1f%% (segment %d/%d, %.1f MB)",
+			pw.index, pw.index, pw.totalFiles, pw.filename, bar, percentage, pw.segsDone, pw.segments, writtenMB)
+	} else {
+		fmt.Printf("\033[%d;0H\033[K[%d/%d] %s [%s] %.1f%% (%.1f/%.1f MB)",
+			pw.index, pw.index, pw.totalFiles, pw.filename, bar, percentage, writtenMB, totalMB)
+	}
+	if pw.attempt > 1 {
+		fmt.Printf(" (attempt %d/%d)", pw.attempt, pw.attempts)
+	}
 
 	// If download is complete, mark with a checkmark and clear the line
-	if pw.written == pw.total {
+	if complete {
 		fmt.Printf(" ✓")
 		// Clear this progress bar after a short delay
 		go func() {
@@ -90,3 +173,14 @@ func (pw *Writer) displayProgress() {
 		fmt.Printf("\033[%d;0H", pw.totalFiles+1)
 	}
 }
+
+// PrintStatus replaces the given progress line with a status message
+func PrintStatus(line int, format string, args ...interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !Interactive {
+		fmt.Printf(format+"\n", args...)
+		return
+	}
+	fmt.Printf("\033[%d;0H\033[K"+format, append([]interface{}{line}, args...)...)
+}
@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxChunk caps a single read so one reader can't grab the whole bucket
+const maxChunk = 32 * 1024
+
+// minChunk is the smallest read, however low the rate
+const minChunk = 256
+
+// chunkTime is how much of the rate a single read may take, so a slow limit
+// means short waits between small reads rather than a long wait after a
+// big one, which a stall timeout would take for a dead connection
+const chunkTime = 250 * time.Millisecond
+
+// Limiter is a token bucket shared by any number of readers.
+// A nil Limiter or a rate of 0 means unlimited.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing bytesPerSecond in total
+func New(bytesPerSecond int64) *Limiter {
+	l := &Limiter{last: time.Now()}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the limit; it takes effect for all readers immediately
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.rate = float64(bytesPerSecond)
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate returns the current limit in bytes per second (0 = unlimited)
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// WaitN blocks until n bytes may be transferred or ctx is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	// Refill, keeping at most one second worth of burst
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	// Take the tokens now and sleep off any debt
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// chunk returns how many bytes a single read may take at the current rate
+func (l *Limiter) chunk() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 {
+		return maxChunk
+	}
+	return min(max(int(l.rate*chunkTime.Seconds()), minChunk), maxChunk)
+}
+
+// Reader wraps r so reads from it count against the limit. Waiting stops
+// when ctx is done.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiter: l}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (lr *reader) Read(p []byte) (int, error) {
+	if chunk := lr.limiter.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if waitErr := lr.limiter.WaitN(lr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// ParseRate parses a rate such as "500K", "2M" or "1.5G" (bytes per second,
+// binary multiples). An empty string or "0" means unlimited; any other rate
+// must be at least 1 byte per second.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "/S"), "B")
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid rate %q (expected e.g. 500K or 2M)", s)
+	}
+	bytes := value * multiplier
+	switch {
+	case value == 0:
+		return 0, nil
+	case bytes < 1:
+		return 0, fmt.Errorf("rate %q is below 1 byte per second (use 0 for unlimited)", s)
+	case bytes >= math.MaxInt64:
+		return 0, fmt.Errorf("rate %q is too large", s)
+	}
+	return int64(bytes), nil
+}
+
+// FormatRate renders a rate for display
+func FormatRate(bytesPerSecond int64) string {
+	switch {
+	case bytesPerSecond <= 0:
+		return "unlimited"
+	case bytesPerSecond >= 1<<20:
+		return fmt.Sprintf("%.1f MB/s", float64(bytesPerSecond)/(1<<20))
+	case bytesPerSecond >= 1<<10:
+		return fmt.Sprintf("%.1f KB/s", float64(bytesPerSecond)/(1<<10))
+	}
+	return fmt.Sprintf("%d B/s", bytesPerSecond)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"  ", 0, false},
+		{"0", 0, false},
+		{"0K", 0, false},
+		{"1", 1, false},
+		{"1.9", 1, false},
+		{"500K", 500 << 10, false},
+		{"500k", 500 << 10, false},
+		{"500KB", 500 << 10, false},
+		{"500KB/s", 500 << 10, false},
+		{"2M", 2 << 20, false},
+		{"2m/s", 2 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{" 64 ", 64, false},
+		{"0.001K", 1, false},
+		{"8000000000G", 8000000000 << 30, false},
+
+		// Below 1 B/s would be read as unlimited
+		{"0.5", 0, true},
+		{"0.0001K", 0, true},
+		// Not finite, or too large for int64
+		{"inf", 0, true},
+		{"+Inf", 0, true},
+		{"infG", 0, true},
+		{"NaN", 0, true},
+		{"9000000000G", 0, true},
+		{"1e300", 0, true},
+		// One unit at most
+		{"5KM", 0, true},
+		{"5MM", 0, true},
+		{"5GK", 0, true},
+		{"K", 0, true},
+		{"-1", 0, true},
+		{"-2M", 0, true},
+		{"fast", 0, true},
+		{"2 M", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, %v; want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "unlimited"},
+		{-1, "unlimited"},
+		{512, "512 B/s"},
+		{1536, "1.5 KB/s"},
+		{2 << 20, "2.0 MB/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatRate(tt.in); got != tt.want {
+			t.Errorf("FormatRate(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
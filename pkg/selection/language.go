@@ -0,0 +1,429 @@
+package selection
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tt6d/pkg/extractor"
+)
+
+// Filter is a parsed selection expression such as
+// "S01-S03,S05E01,S05E03..S05E06,!S01E02,latest:3". Items are separated by
+// commas; the selection is every item added together, minus the items
+// starting with "!". An expression with only "!" items starts from every
+// episode.
+//
+// Items:
+//
+//	S02          a whole season
+//	S02E04       one episode (S02E04E05 for a double episode)
+//	S01-S03      a range, written with "-" or ".."; the end may be
+//	S02E04-E09   just an episode in the same season
+//	S02E04-      from an episode (or season) to the last one
+//	..S02E04     from the first episode up to one
+//	latest:3     the three newest episodes that can be downloaded
+//	latest       the newest one
+//	specials     season 0
+//	all, *       everything
+//
+// Ranges never reach into the specials unless they start or end in S00.
+type Filter struct {
+	input string
+	items []item
+}
+
+// SyntaxError is an error in a selection expression
+type SyntaxError struct {
+	Input   string
+	Column  int // 1-based
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+// Pointer returns the expression with a caret under the error, for
+// printing below the error message
+func (e *SyntaxError) Pointer() string {
+	return e.Input + "\n" + strings.Repeat(" ", e.Column-1) + "^"
+}
+
+type itemKind int
+
+const (
+	itemRange itemKind = iota
+	itemLatest
+	itemAll
+)
+
+// item is one comma separated part of an expression
+type item struct {
+	kind   itemKind
+	negate bool
+	from   bound // unset for an open start
+	to     bound // unset for an open end
+	count  int   // for latest
+	column int
+	text   string
+}
+
+// bound is one end of a range. An end without an episode covers the whole
+// season.
+type bound struct {
+	set        bool
+	season     int
+	episode    int // 0 if not given
+	last       int // the second number of a double episode, else episode
+	hasEpisode bool
+}
+
+// Parse reads a selection expression
+func Parse(input string) (*Filter, error) {
+	p := &parser{input: input}
+	f := &Filter{input: input}
+	for {
+		p.skipSpace()
+		it, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		f.items = append(f.items, it)
+
+		p.skipSpace()
+		if p.done() {
+			return f, nil
+		}
+		if !p.accept(",") {
+			return nil, p.errorf("expected \",\" between items")
+		}
+	}
+}
+
+// String returns the expression as it was written
+func (f *Filter) String() string {
+	return f.input
+}
+
+// parser reads an expression from left to right
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes s, ignoring case, if it comes next
+func (p *parser) accept(s string) bool {
+	if len(p.input)-p.pos >= len(s) && strings.EqualFold(p.input[p.pos:p.pos+len(s)], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// acceptWord consumes a keyword that is not followed by more letters
+func (p *parser) acceptWord(word string) bool {
+	start := p.pos
+	if !p.accept(word) {
+		return false
+	}
+	if c := p.peek(); (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		p.pos = start
+		return false
+	}
+	return true
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Input: p.input, Column: p.pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+// number reads a decimal number
+func (p *parser) number(what string) (int, error) {
+	start := p.pos
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("expected %s number", what)
+	}
+	n, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("%s number is too large", what)
+	}
+	return n, nil
+}
+
+func (p *parser) item() (item, error) {
+	it := item{column: p.pos + 1}
+	start := p.pos
+	if p.accept("!") {
+		it.negate = true
+		p.skipSpace()
+	}
+
+	switch {
+	case p.acceptWord("latest"):
+		it.kind = itemLatest
+		it.count = 1
+		if p.accept(":") {
+			column := p.pos
+			n, err := p.number("episode count")
+			if err != nil {
+				return it, err
+			}
+			if n < 1 {
+				p.pos = column
+				return it, p.errorf("latest needs a count of at least 1")
+			}
+			it.count = n
+		}
+	case p.acceptWord("all") || p.accept("*"):
+		it.kind = itemAll
+	case p.acceptWord("specials"):
+		it.from = bound{set: true}
+		it.to = it.from
+	default:
+		if err := p.rangeItem(&it); err != nil {
+			return it, err
+		}
+	}
+
+	it.text = strings.TrimSpace(p.input[start:p.pos])
+	return it, nil
+}
+
+// rangeItem reads a single episode, a season or a range
+func (p *parser) rangeItem(it *item) error {
+	if p.done() || p.peek() == ',' {
+		return p.errorf("expected an episode such as S01E02, a season such as S01, latest or all")
+	}
+
+	if !p.rangeSeparator() {
+		from, err := p.bound(-1)
+		if err != nil {
+			return err
+		}
+		it.from = from
+		p.skipSpace()
+		if !p.rangeSeparator() {
+			it.to = from
+			return nil
+		}
+	}
+
+	// Open end
+	p.skipSpace()
+	if p.done() || p.peek() == ',' {
+		if !it.from.set {
+			return p.errorf("expected the end of the range")
+		}
+		return nil
+	}
+
+	season := -1
+	if it.from.set && it.from.hasEpisode {
+		season = it.from.season
+	}
+	column := p.pos
+	to, err := p.bound(season)
+	if err != nil {
+		return err
+	}
+	if it.from.set && endsBefore(to, it.from) {
+		p.pos = column
+		return p.errorf("range ends before it starts")
+	}
+	it.to = to
+	return nil
+}
+
+// rangeSeparator consumes "-" or ".."
+func (p *parser) rangeSeparator() bool {
+	return p.accept("..") || p.accept("-")
+}
+
+// bound reads S01, S01E02 or S01E02E03, or E05 when season is not -1
+func (p *parser) bound(season int) (bound, error) {
+	b := bound{set: true}
+	switch {
+	case p.accept("S"):
+		n, err := p.number("season")
+		if err != nil {
+			return b, err
+		}
+		b.season = n
+	case season >= 0 && (p.peek() == 'E' || p.peek() == 'e'):
+		b.season = season
+	case season >= 0:
+		return b, p.errorf("expected a season such as S01 or an episode such as E05")
+	default:
+		return b, p.errorf("expected a season such as S01 or an episode such as S01E02")
+	}
+
+	if p.accept("E") {
+		n, err := p.number("episode")
+		if err != nil {
+			return b, err
+		}
+		b.episode, b.last, b.hasEpisode = n, n, true
+		// A double episode selects both of its numbers
+		if p.accept("E") {
+			column := p.pos
+			last, err := p.number("episode")
+			if err != nil {
+				return b, err
+			}
+			if last < n {
+				p.pos = column
+				return b, p.errorf("double episode ends before it starts")
+			}
+			b.last = last
+		}
+	}
+	return b, nil
+}
+
+// endsBefore reports whether the end of a range comes before its start
+func endsBefore(to, from bound) bool {
+	if to.season != from.season {
+		return to.season < from.season
+	}
+	return to.hasEpisode && from.hasEpisode && to.last < from.episode
+}
+
+// contains reports whether an episode is in a range item
+func (it item) contains(n extractor.EpisodeNumber) bool {
+	// Specials are only reached by ranges anchored in season 0
+	anchor := it.from
+	if !anchor.set {
+		anchor = it.to
+	}
+	if n.IsSpecial() != (anchor.season == 0) {
+		return false
+	}
+
+	last := n.Episode
+	if n.Last > 0 {
+		last = n.Last
+	}
+	if it.from.set {
+		if n.Season < it.from.season {
+			return false
+		}
+		if n.Season == it.from.season && it.from.hasEpisode && last < it.from.episode {
+			return false
+		}
+	}
+	if it.to.set {
+		if n.Season > it.to.season {
+			return false
+		}
+		if n.Season == it.to.season && it.to.hasEpisode && n.Episode > it.to.last {
+			return false
+		}
+	}
+	return true
+}
+
+// Episodes applies the filter to a series and returns the selected
+// episodes in page order. Items that select nothing are reported, so a
+// typo doesn't quietly shrink the selection.
+func (f *Filter) Episodes(info *extractor.TVSeriesInfo) ([]extractor.Episode, error) {
+	all := info.Episodes()
+	selected := make([]bool, len(all))
+
+	positive := false
+	for _, it := range f.items {
+		if !it.negate {
+			positive = true
+		}
+	}
+	if !positive {
+		for i := range selected {
+			selected[i] = true
+		}
+	}
+
+	for _, it := range f.items {
+		matches := it.matches(all)
+		if len(matches) == 0 && !it.negate {
+			return nil, fmt.Errorf("%q at column %d matches no episode on the page", it.text, it.column)
+		}
+		for _, i := range matches {
+			selected[i] = !it.negate
+		}
+	}
+
+	var episodes []extractor.Episode
+	for i, ep := range all {
+		if selected[i] {
+			episodes = append(episodes, ep)
+		}
+	}
+	if len(episodes) == 0 {
+		return nil, fmt.Errorf("%q selects no episodes", f.input)
+	}
+	return episodes, nil
+}
+
+// matches returns the indexes of the episodes an item selects
+func (it item) matches(all []extractor.Episode) []int {
+	var indexes []int
+	switch it.kind {
+	case itemAll:
+		for i := range all {
+			indexes = append(indexes, i)
+		}
+	case itemLatest:
+		indexes = newest(all, it.count)
+	default:
+		for i, ep := range all {
+			if it.contains(ep.Number()) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+// newest returns the indexes of the n newest episodes that have links,
+// taking regular seasons before specials
+func newest(all []extractor.Episode, n int) []int {
+	var available []int
+	for i, ep := range all {
+		if len(ep.Links) > 0 {
+			available = append(available, i)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		a, b := all[available[i]].Number(), all[available[j]].Number()
+		if a.IsSpecial() != b.IsSpecial() {
+			return !a.IsSpecial()
+		}
+		return a.Compare(b) > 0
+	})
+	if len(available) > n {
+		available = available[:n]
+	}
+	return available
+}
@@ -0,0 +1,223 @@
+package selection
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tt6d/pkg/extractor"
+)
+
+// fixtureSeries has seasons 1 to 5 without season 4, a double episode, an
+// episode without links and two specials
+func fixtureSeries() *extractor.TVSeriesInfo {
+	info := &extractor.TVSeriesInfo{Title: "Example", Seasons: map[string][]extractor.Episode{}}
+	add := func(season string, ids ...string) {
+		for _, id := range ids {
+			n, _ := extractor.ParseEpisodeID(id)
+			ep := extractor.Episode{ID: id, Season: n.Season, Episode: n.Episode, LastEpisode: n.Last, Links: []string{"https://example.com/" + id + ".mp4"}}
+			// The newest episode is announced but not out yet
+			if id == "S05E06" {
+				ep.Links = nil
+			}
+			info.Seasons[season] = append(info.Seasons[season], ep)
+		}
+	}
+	add("1", "S01E01", "S01E02", "S01E03")
+	add("2", "S02E01", "S02E02", "S02E03", "S02E04E05", "S02E06", "S02E07", "S02E08", "S02E09", "S02E10")
+	add("3", "S03E01", "S03E02")
+	add("5", "S05E01", "S05E02", "S05E03", "S05E04", "S05E05", "S05E06")
+	add("0", "S00E01", "S00E02")
+	return info
+}
+
+func TestFilterEpisodes(t *testing.T) {
+	season1 := "S01E01 S01E02 S01E03 "
+	season2 := "S02E01 S02E02 S02E03 S02E04E05 S02E06 S02E07 S02E08 S02E09 S02E10 "
+	season3 := "S03E01 S03E02 "
+	season5 := "S05E01 S05E02 S05E03 S05E04 S05E05 S05E06 "
+	specials := "S00E01 S00E02"
+	everything := season1 + season2 + season3 + season5 + specials
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Seasons and episodes
+		{"S01", season1},
+		{"S01E02", "S01E02"},
+		{"s01e02", "S01E02"},
+		{"S01E02,S01E01", "S01E01 S01E02"},
+
+		// Ranges
+		{"S01-S03", season1 + season2 + season3},
+		{"S01..S03", season1 + season2 + season3},
+		{"S01 - S02", season1 + season2},
+		{"S01E02-S02E02", "S01E02 S01E03 S02E01 S02E02"},
+		{"S02E04-E09", "S02E04E05 S02E06 S02E07 S02E08 S02E09"},
+		{"S02E06..E07", "S02E06 S02E07"},
+		{"S05E01,S05E03..S05E06", "S05E01 S05E03 S05E04 S05E05 S05E06"},
+
+		// Open ranges stay out of the specials
+		{"S02E04-", "S02E04E05 S02E06 S02E07 S02E08 S02E09 S02E10 " + season3 + season5},
+		{"S03-", season3 + season5},
+		{"..S02E04", season1 + "S02E01 S02E02 S02E03 S02E04E05"},
+		{"..S01", season1},
+
+		// Double episodes are selected by either number
+		{"S02E04E05", "S02E04E05"},
+		{"S02E04", "S02E04E05"},
+		{"S02E05", "S02E04E05"},
+		{"S02E05-E06", "S02E04E05 S02E06"},
+
+		// Newest episodes with links, in page order
+		{"latest", "S05E05"},
+		{"LATEST:3", "S05E03 S05E04 S05E05"},
+		{"latest:3,S01E01", "S01E01 S05E03 S05E04 S05E05"},
+		{"latest:100", strings.Replace(everything, "S05E06 ", "", 1)},
+
+		// Specials
+		{"specials", specials},
+		{"S00E02", "S00E02"},
+		{"S00E02-", "S00E02"},
+		{"S05,specials", season5 + specials},
+
+		// Everything
+		{"all", everything},
+		{"*", everything},
+		{"all,!specials", season1 + season2 + season3 + season5},
+
+		// Exclusions
+		{"S01,!S01E02", "S01E01 S01E03"},
+		{"!S01E02", strings.Replace(everything, "S01E02 ", "", 1)},
+		{"!S02-S05, !specials", season1},
+		{"S02E04-E09, ! S02E06-E08", "S02E04E05 S02E09"},
+		{"S05,!latest:2", "S05E01 S05E02 S05E03 S05E06"},
+		// Later items win
+		{"!S01E02,S01", season1},
+	}
+
+	info := fixtureSeries()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			episodes, err := f.Episodes(info)
+			if err != nil {
+				t.Fatalf("Episodes: %v", err)
+			}
+			var got []string
+			for _, ep := range episodes {
+				got = append(got, ep.ID)
+			}
+			if want := sortedIDs(strings.Fields(tt.want)); !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+// sortedIDs puts IDs in the order info.Episodes lists them
+func sortedIDs(ids []string) []string {
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var sorted []string
+	for _, ep := range fixtureSeries().Episodes() {
+		if wanted[ep.ID] {
+			sorted = append(sorted, ep.ID)
+		}
+	}
+	return sorted
+}
+
+func TestFilterEpisodesErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"S04", `"S04" at column 1 matches no episode on the page`},
+		{"S01, S02E11", `"S02E11" at column 6 matches no episode on the page`},
+		{"S00E03-", `"S00E03-" at column 1 matches no episode on the page`},
+		{"S01E02,!S01", `"S01E02,!S01" selects no episodes`},
+		{"!all", `"!all" selects no episodes`},
+	}
+
+	info := fixtureSeries()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			_, err = f.Episodes(info)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		column  int
+		message string
+	}{
+		{"S01E02-E01", 8, "range ends before it starts"},
+		{"S03-S01", 5, "range ends before it starts"},
+		{"S02E05..S02E01", 9, "range ends before it starts"},
+		{"S01E02E01", 8, "double episode ends before it starts"},
+		{"latest:0", 8, "latest needs a count of at least 1"},
+		{"latest:", 8, "expected episode count number"},
+		{"latest:x", 8, "expected episode count number"},
+		{"S01,", 5, "expected an episode such as S01E02, a season such as S01, latest or all"},
+		{"S01,,S02", 5, "expected an episode such as S01E02, a season such as S01, latest or all"},
+		{"", 1, "expected an episode such as S01E02, a season such as S01, latest or all"},
+		{"E05", 1, "expected a season such as S01 or an episode such as S01E02"},
+		{"S01-E05", 5, "expected a season such as S01 or an episode such as S01E02"},
+		{"S01E02-05", 8, "expected a season such as S01 or an episode such as E05"},
+		{"S", 2, "expected season number"},
+		{"S01E", 5, "expected episode number"},
+		{"S99999999999999999999", 2, "season number is too large"},
+		{"-", 2, "expected the end of the range"},
+		{"..", 3, "expected the end of the range"},
+		{"S01 S02", 5, `expected "," between items`},
+		{"latestx", 1, "expected a season such as S01 or an episode such as S01E02"},
+		{"alls", 1, "expected a season such as S01 or an episode such as S01E02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%q) = %v, want a syntax error", tt.expr, err)
+			}
+			if syntaxErr.Column != tt.column || syntaxErr.Message != tt.message {
+				t.Errorf("got column %d %q, want column %d %q", syntaxErr.Column, syntaxErr.Message, tt.column, tt.message)
+			}
+			if syntaxErr.Input != tt.expr {
+				t.Errorf("Input = %q, want %q", syntaxErr.Input, tt.expr)
+			}
+		})
+	}
+}
+
+func TestSyntaxErrorPointer(t *testing.T) {
+	_, err := Parse("S01E02-E01")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("got %v, want a syntax error", err)
+	}
+	if got, want := syntaxErr.Error(), "column 8: range ends before it starts"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := syntaxErr.Pointer(), "S01E02-E01\n       ^"; got != want {
+		t.Errorf("Pointer() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package selection
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tt6d/pkg/extractor"
+)
+
+// Criteria describes which episodes or links to download without asking
+type Criteria struct {
+	// All selects everything on the page
+	All bool
+	// Seasons selects whole seasons by number; 0 is the specials
+	Seasons []int
+	// Episodes selects episodes with a selection expression such as
+	// "S02E01-S02E05,S02E08"
+	Episodes *Filter
+	// Latest keeps only the newest of the selected episodes
+	Latest bool
+	// Match keeps only links, or episodes with an ID, title or link, that
+	// match the expression
+	Match *regexp.Regexp
+}
+
+// IsSet reports whether any criteria were given, so the selection can be
+// made without the interactive selector
+func (c Criteria) IsSet() bool {
+	return c.All || len(c.Seasons) > 0 || c.Episodes != nil || c.Latest || c.Match != nil
+}
+
+// ParseSeasons reads a comma separated list of season numbers, where
+// "specials" or 0 stands for the specials
+func ParseSeasons(s string) ([]int, error) {
+	var seasons []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if strings.EqualFold(part, "specials") {
+			seasons = append(seasons, 0)
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(part), "S"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid season %q", part)
+		}
+		seasons = append(seasons, n)
+	}
+	return seasons, nil
+}
+
+// Episodes returns the episodes of a series that match the criteria, in
+// page order. It fails if a requested season or episode is not on the
+// page, or if nothing is left.
+func Episodes(info *extractor.TVSeriesInfo, c Criteria) ([]extractor.Episode, error) {
+	all := info.Episodes()
+
+	// Start from the seasons and episodes asked for, or everything
+	selected := make(map[string]bool)
+	everything := c.All || (len(c.Seasons) == 0 && c.Episodes == nil)
+	for _, season := range c.Seasons {
+		found := false
+		for _, ep := range all {
+			if ep.Number().Season == season {
+				selected[ep.ID], found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("season %d is not on the page (available: %s)", season, availableSeasons(info))
+		}
+	}
+	if c.Episodes != nil {
+		episodes, err := c.Episodes.Episodes(info)
+		if err != nil {
+			return nil, err
+		}
+		for _, ep := range episodes {
+			selected[ep.ID] = true
+		}
+	}
+
+	var episodes []extractor.Episode
+	for _, ep := range all {
+		if (everything || selected[ep.ID]) && matchesEpisode(c.Match, ep) {
+			episodes = append(episodes, ep)
+		}
+	}
+	if len(episodes) == 0 {
+		return nil, fmt.Errorf("no episodes match the selection")
+	}
+
+	if c.Latest {
+		// Pages often list the next episode before it can be downloaded
+		latest := newest(episodes, 1)
+		if len(latest) == 0 {
+			return nil, fmt.Errorf("none of the selected episodes has download links yet")
+		}
+		episodes = []extractor.Episode{episodes[latest[0]]}
+	}
+	return episodes, nil
+}
+
+// Links returns the links that match the criteria, in page order
+func Links(links []string, c Criteria) ([]string, error) {
+	if len(c.Seasons) > 0 || c.Episodes != nil {
+		return nil, fmt.Errorf("the page has no seasons or episodes, only links")
+	}
+
+	var selected []string
+	for _, link := range links {
+		if c.Match == nil || c.Match.MatchString(link) {
+			selected = append(selected, link)
+		}
+	}
+	if len(selected) == 0 && c.Match != nil {
+		return nil, fmt.Errorf("no links match %q", c.Match)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no links on the page")
+	}
+	if c.Latest {
+		// Pages list links in no particular order, so the last one is the best guess
+		selected = selected[len(selected)-1:]
+	}
+	return selected, nil
+}
+
+// matchesEpisode reports whether an episode's ID, title or one of its
+// links matches re
+func matchesEpisode(re *regexp.Regexp, ep extractor.Episode) bool {
+	if re == nil || re.MatchString(ep.ID) || (ep.Title != "" && re.MatchString(ep.Title)) {
+		return true
+	}
+	for _, link := range ep.Links {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// availableSeasons lists the season labels of a series for error messages
+func availableSeasons(info *extractor.TVSeriesInfo) string {
+	var labels []string
+	for _, season := range info.SeasonNames() {
+		labels = append(labels, extractor.SeasonLabel(season))
+	}
+	return strings.Join(labels, ", ")
+}
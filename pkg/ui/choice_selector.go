@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// choiceModel picks exactly one item from a list
+type choiceModel struct {
+	title  string
+	items  []string
+	cursor int
+	chosen bool
+}
+
+func (m choiceModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m choiceModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "j":
+			if m.cursor < len(m.items)-1 {
+				m.cursor++
+			}
+
+		case "enter", " ":
+			m.chosen = true
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m choiceModel) View() string {
+	s := titleStyle.Render(m.title) + "\n\n"
+
+	for i, item := range m.items {
+		cursor := " "
+		if m.cursor == i {
+			cursor = "▸"
+		}
+
+		line := fmt.Sprintf("%s %s", cursor, item)
+		if m.cursor == i {
+			s += selectedItemStyle.Render(line)
+		} else {
+			s += itemStyle.Render(line)
+		}
+		s += "\n"
+	}
+
+	s += "\n" + footerStyle.Render("Navigation: ↑/↓ or j/k • enter: choose • q: cancel")
+	return s
+}
+
+// SelectOne lets the user choose one of items and returns its index
+func SelectOne(ctx context.Context, title string, items []string) (int, error) {
+	p := tea.NewProgram(choiceModel{
+		title: title,
+		items: items,
+	}, tea.WithContext(ctx))
+
+	m, err := p.Run()
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to run UI: %v", err)
+	}
+
+	finalModel := m.(choiceModel)
+	if !finalModel.chosen {
+		return 0, fmt.Errorf("nothing chosen")
+	}
+	return finalModel.cursor, nil
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,6 +18,7 @@ type model struct {
 	links    []string
 	cursor   int
 	selected map[int]bool
+	present  map[int]bool // links already in the download folder
 	viewport struct {
 		start int
 		size  int
@@ -176,6 +178,9 @@ func (m model) View() string {
 		}
 
 		item := fmt.Sprintf("%s %s %s", cursor, checked, displayLink)
+		if m.present[i] {
+			item += presentMark
+		}
 
 		if m.cursor == i {
 			s += selectedItemStyle.Render(item)
@@ -197,13 +202,26 @@ func (m model) View() string {
 	return s
 }
 
-func GetSelectedLinks(links []string) ([]string, error) {
+// GetSelectedLinks lets the user pick links to download. Links for which
+// downloaded returns true are marked as already present; downloaded may be nil.
+func GetSelectedLinks(ctx context.Context, links []string, downloaded func(link string) bool) ([]string, error) {
+	present := make(map[int]bool)
+	for i, link := range links {
+		if downloaded != nil && downloaded(link) {
+			present[i] = true
+		}
+	}
+
 	p := tea.NewProgram(model{
 		links:    links,
 		selected: make(map[int]bool),
-	})
+		present:  present,
+	}, tea.WithContext(ctx))
 
 	m, err := p.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to run UI: %v", err)
 	}
@@ -213,9 +231,12 @@ func GetSelectedLinks(links []string) ([]string, error) {
 		return nil, fmt.Errorf("no files selected")
 	}
 
+	// Keep the page order rather than the map's
 	var selectedLinks []string
-	for i := range finalModel.selected {
-		selectedLinks = append(selectedLinks, links[i])
+	for i, link := range links {
+		if finalModel.selected[i] {
+			selectedLinks = append(selectedLinks, link)
+		}
 	}
 
 	return selectedLinks, nil
@@ -1,27 +1,37 @@
 package ui
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"strings"
 
 	"tt6d/pkg/extractor"
+	"tt6d/pkg/selection"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 type seriesModel struct {
+	info          *extractor.TVSeriesInfo
 	title         string
 	seasons       []string
 	episodes      map[string][]extractor.Episode
 	cursor        int
 	selected      map[string]bool
 	selectedEps   map[string]bool
+	present       map[string]bool // episodes already in the download folder
 	currentState  viewState
 	currentSeason string
 	viewport      struct {
 		start int
 		size  int
 	}
+
+	// The "/" prompt for a selection expression
+	prompting bool
+	input     string
+	promptErr string
+	status    string
 }
 
 type viewState int
@@ -40,6 +50,9 @@ func (m seriesModel) Init() tea.Cmd {
 func (m seriesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.prompting {
+			return m.updatePrompt(msg)
+		}
 
 		switch msg.String() {
 		case "ctrl+c", "q":
@@ -74,7 +87,11 @@ func (m seriesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// Space toggles episode selection
 				if episodes := m.episodes[m.currentSeason]; len(episodes) > 0 {
 					epID := episodes[m.cursor].ID
-					m.selectedEps[epID] = !m.selectedEps[epID]
+					if m.selectedEps[epID] {
+						delete(m.selectedEps, epID)
+					} else {
+						m.selectedEps[epID] = true
+					}
 					if m.cursor < len(episodes)-1 {
 						m.cursor++
 					}
@@ -118,12 +135,74 @@ func (m seriesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.currentState == episodeSelect {
 				m.selectedEps = make(map[string]bool)
 			}
+
+		case "/":
+			m.prompting = true
+			m.promptErr = ""
+			m.status = ""
+
+		case "d":
+			// Download the selection from any screen
+			if len(m.selectedEps) > 0 {
+				return m, tea.Quit
+			}
 		}
 	}
 
 	return m, nil
 }
 
+// updatePrompt edits the selection expression and applies it on enter,
+// replacing the current selection
+func (m seriesModel) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.selectedEps = make(map[string]bool)
+		return m, tea.Quit
+
+	case tea.KeyEsc:
+		m.prompting = false
+		m.promptErr = ""
+
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+		m.promptErr = ""
+
+	case tea.KeyEnter:
+		filter, err := selection.Parse(m.input)
+		if err != nil {
+			m.promptErr = err.Error()
+			if syntaxErr, ok := err.(*selection.SyntaxError); ok {
+				m.promptErr += "\n" + syntaxErr.Pointer()
+			}
+			return m, nil
+		}
+		episodes, err := filter.Episodes(m.info)
+		if err != nil {
+			m.promptErr = err.Error()
+			return m, nil
+		}
+		m.selectedEps = make(map[string]bool)
+		for _, ep := range episodes {
+			m.selectedEps[ep.ID] = true
+		}
+		m.prompting = false
+		m.promptErr = ""
+		m.status = fmt.Sprintf("%d episodes selected", len(episodes))
+
+	case tea.KeySpace:
+		m.input += " "
+
+	case tea.KeyRunes:
+		m.input += string(msg.Runes)
+		m.promptErr = ""
+	}
+	return m, nil
+}
+
 func (m seriesModel) currentItems() []string {
 	switch m.currentState {
 	case seasonSelect:
@@ -157,7 +236,7 @@ func (m seriesModel) View() string {
 				checked = "[✓]"
 			}
 
-			item := fmt.Sprintf("%s %s Season %s", cursor, checked, season)
+			item := fmt.Sprintf("%s %s %s", cursor, checked, extractor.SeasonLabel(season))
 
 			if m.cursor == i {
 				s += seasonStyle.Render(item)
@@ -168,7 +247,7 @@ func (m seriesModel) View() string {
 		}
 
 	case episodeSelect:
-		s += seasonStyle.Render(fmt.Sprintf("Season %s Episodes:", m.currentSeason)) + "\n\n"
+		s += seasonStyle.Render(fmt.Sprintf("%s Episodes:", extractor.SeasonLabel(m.currentSeason))) + "\n\n"
 
 		episodes := m.episodes[m.currentSeason]
 		for i, ep := range episodes {
@@ -183,6 +262,12 @@ func (m seriesModel) View() string {
 			}
 
 			item := fmt.Sprintf("%s %s %s", cursor, checked, ep.ID)
+			if details := episodeDetails(ep); details != "" {
+				item += detailStyle.Render("  " + details)
+			}
+			if m.present[ep.ID] {
+				item += presentMark
+			}
 
 			if m.cursor == i {
 				s += selectedItemStyle.Render(item)
@@ -193,36 +278,73 @@ func (m seriesModel) View() string {
 		}
 	}
 
+	if m.prompting {
+		s += "\n" + infoStyle.Render("Select: ") + m.input + "█\n"
+		if m.promptErr != "" {
+			s += errorStyle.Render(m.promptErr) + "\n"
+		}
+		s += "\n" + footerStyle.Render("e.g. S01-S03, S02E04-, S05E01,S05E03..S05E06, latest:3, !S01E02 • enter: apply • esc: cancel")
+		return s
+	}
+	if m.status != "" {
+		s += "\n" + infoStyle.Render(m.status) + "\n"
+	}
+
 	// Help footer
 	s += "\n" + footerStyle.Render("Navigation: ↑/↓ or j/k • Enter: next • Esc: back")
 	if m.currentState == episodeSelect {
-		s += "\n" + footerStyle.Render("Actions: space: select • a: select all • n: none • enter: confirm")
+		s += "\n" + footerStyle.Render("Actions: space: select • a: select all • n: none • /: select by expression • enter: confirm")
 	} else {
-		s += "\n" + footerStyle.Render("Actions: space: select • enter: next • q: quit")
+		s += "\n" + footerStyle.Render("Actions: space: select • /: select by expression • d: download selection • q: quit")
 	}
 
 	return s
 }
 
-func SelectTVSeriesEpisodes(info *extractor.TVSeriesInfo) ([]string, error) {
-	var seasons []string
-	for season := range info.Seasons {
-		seasons = append(seasons, season)
+// episodeDetails describes the metadata of an episode for the list
+func episodeDetails(ep extractor.Episode) string {
+	var details []string
+	if ep.Title != "" {
+		details = append(details, ep.Title)
+	}
+	if ep.Size > 0 {
+		details = append(details, extractor.FormatSize(ep.Size))
+	}
+	if ep.Quality != "" {
+		details = append(details, ep.Quality)
+	}
+	if len(ep.Links) > 1 {
+		details = append(details, fmt.Sprintf("%d mirrors", len(ep.Links)))
 	}
+	return strings.Join(details, " • ")
+}
 
-	// Sort seasons
-	sort.Strings(seasons)
+// SelectTVSeriesEpisodes lets the user pick episodes to download. Episodes
+// for which downloaded returns true are marked as already present;
+// downloaded may be nil.
+func SelectTVSeriesEpisodes(ctx context.Context, info *extractor.TVSeriesInfo, downloaded func(ep extractor.Episode) bool) ([]extractor.Episode, error) {
+	present := make(map[string]bool)
+	for _, ep := range info.Episodes() {
+		if downloaded != nil && downloaded(ep) {
+			present[ep.ID] = true
+		}
+	}
 
 	p := tea.NewProgram(seriesModel{
+		info:         info,
 		title:        info.Title,
-		seasons:      seasons,
+		seasons:      info.SeasonNames(),
 		episodes:     info.Seasons,
 		selected:     make(map[string]bool),
 		selectedEps:  make(map[string]bool),
+		present:      present,
 		currentState: seasonSelect,
-	})
+	}, tea.WithContext(ctx))
 
 	m, err := p.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to run UI: %v", err)
 	}
@@ -232,24 +354,13 @@ func SelectTVSeriesEpisodes(info *extractor.TVSeriesInfo) ([]string, error) {
 		return nil, fmt.Errorf("no episodes selected")
 	}
 
-	// Use a map to deduplicate links
-	linkMap := make(map[string]bool)
-	var selectedLinks []string
-
-	// Collect unique links from selected episodes
-	for _, episodes := range info.Seasons {
-		for _, ep := range episodes {
-			if finalModel.selectedEps[ep.ID] {
-				// Only add links we haven't seen before
-				for _, link := range ep.Links {
-					if !linkMap[link] {
-						linkMap[link] = true
-						selectedLinks = append(selectedLinks, link)
-					}
-				}
-			}
+	// Queue the episodes in page order
+	var selected []extractor.Episode
+	for _, ep := range info.Episodes() {
+		if finalModel.selectedEps[ep.ID] {
+			selected = append(selected, ep)
 		}
 	}
 
-	return selectedLinks, nil
+	return selected, nil
 }
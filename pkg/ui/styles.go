@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"fmt"
+
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -33,3 +35,61 @@ var (
 			MarginTop(1).
 			Foreground(lipgloss.Color("#888888"))
 )
+
+// detailStyle renders the metadata shown after an item
+var detailStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#888888"))
+
+// presentMark is appended to items that are already downloaded
+var presentMark = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#888888")).
+	Render(" (downloaded)")
+
+// errorStyle renders problems such as an invalid selection expression
+var errorStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#FF5F5F")).
+	MarginLeft(2)
+
+// theme is a set of colours for the styles above
+type theme struct {
+	accent, heading, muted, problem lipgloss.TerminalColor
+}
+
+var themes = map[string]theme{
+	"default": {
+		accent:  lipgloss.Color("#00FF00"),
+		heading: lipgloss.Color("#FFD700"),
+		muted:   lipgloss.Color("#888888"),
+		problem: lipgloss.Color("#FF5F5F"),
+	},
+	// Darker colours that stay readable on a light background
+	"light": {
+		accent:  lipgloss.Color("#007700"),
+		heading: lipgloss.Color("#8A6D00"),
+		muted:   lipgloss.Color("#666666"),
+		problem: lipgloss.Color("#C00000"),
+	},
+	"mono": {
+		accent:  lipgloss.NoColor{},
+		heading: lipgloss.NoColor{},
+		muted:   lipgloss.NoColor{},
+		problem: lipgloss.NoColor{},
+	},
+}
+
+// SetTheme switches the colours of the selectors
+func SetTheme(name string) error {
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q (use default, light or mono)", name)
+	}
+	titleStyle = titleStyle.Foreground(t.accent)
+	infoStyle = infoStyle.Foreground(t.muted)
+	seasonStyle = seasonStyle.Foreground(t.heading)
+	selectedItemStyle = selectedItemStyle.Foreground(t.accent)
+	footerStyle = footerStyle.Foreground(t.muted)
+	detailStyle = detailStyle.Foreground(t.muted)
+	presentMark = lipgloss.NewStyle().Foreground(t.muted).Render(" (downloaded)")
+	errorStyle = errorStyle.Foreground(t.problem)
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package watch keeps the list of followed series and the episodes already
+// seen on each of them, so that only new episodes are downloaded
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"tt6d/pkg/datafile"
+	"tt6d/pkg/extractor"
+)
+
+// stateVersion is bumped when the state format changes incompatibly
+const stateVersion = 1
+
+// Subscription is a followed series page
+type Subscription struct {
+	URL string `json:"url"`
+	// Folder is where new episodes are downloaded
+	Folder string `json:"folder"`
+	Title  string `json:"title,omitempty"`
+	// Known are the IDs of the episodes that were downloaded or were on the
+	// page when the series was added
+	Known   []string  `json:"known"`
+	Added   time.Time `json:"added"`
+	Checked time.Time `json:"checked"`
+}
+
+// State is the list of subscriptions, kept in a JSON file
+type State struct {
+	path          string
+	Version       int             `json:"version"`
+	Subscriptions []*Subscription `json:"subscriptions"`
+}
+
+// DefaultStatePath returns watch.json in the tt6d data folder
+// (~/.local/share/tt6d unless XDG_DATA_HOME is set)
+func DefaultStatePath() string {
+	return datafile.Path("watch.json")
+}
+
+// Load reads the state file, or starts an empty state if there is none
+func Load(path string) (*State, error) {
+	s := &State{path: path, Version: stateVersion}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch state: %v", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse watch state %s: %v", path, err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported watch state version %d in %s", s.Version, path)
+	}
+	return s, nil
+}
+
+// Save writes the state atomically so a crash never leaves it half written
+func (s *State) Save() error {
+	if err := datafile.WriteJSON(s.path, s); err != nil {
+		return fmt.Errorf("failed to write watch state: %v", err)
+	}
+	return nil
+}
+
+// Update locks the state file, reads it again, applies change and saves
+// it, so that changes saved by other tt6d commands are kept
+func Update(path string, change func(*State) error) error {
+	unlock, err := datafile.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := Load(path)
+	if err != nil {
+		return err
+	}
+	if err := change(s); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// Merge records the result of checking sub: its title, the time of the
+// check and the episodes now known. Nothing changes if sub is no longer
+// watched.
+func (s *State) Merge(sub *Subscription) {
+	current := s.Find(sub.URL)
+	if current == nil {
+		return
+	}
+	current.Title = sub.Title
+	current.Checked = sub.Checked
+	current.MarkKnown(sub.Known...)
+}
+
+// Find returns the subscription for a page, or nil
+func (s *State) Find(pageURL string) *Subscription {
+	for _, sub := range s.Subscriptions {
+		if sub.URL == pageURL {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Add subscribes to a series page
+func (s *State) Add(sub *Subscription) error {
+	if s.Find(sub.URL) != nil {
+		return fmt.Errorf("already watching %s", sub.URL)
+	}
+	if sub.Added.IsZero() {
+		sub.Added = time.Now()
+	}
+	s.Subscriptions = append(s.Subscriptions, sub)
+	return nil
+}
+
+// Remove unsubscribes from a page and reports whether it was watched
+func (s *State) Remove(pageURL string) bool {
+	for i, sub := range s.Subscriptions {
+		if sub.URL == pageURL {
+			s.Subscriptions = append(s.Subscriptions[:i], s.Subscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// IsKnown reports whether an episode was seen before
+func (sub *Subscription) IsKnown(id string) bool {
+	for _, known := range sub.Known {
+		if known == id {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkKnown records episodes as seen
+func (sub *Subscription) MarkKnown(ids ...string) {
+	for _, id := range ids {
+		if !sub.IsKnown(id) {
+			sub.Known = append(sub.Known, id)
+		}
+	}
+}
+
+// NewEpisodes returns the episodes of a series that were not seen before,
+// in page order. Episodes listed without links yet are left for a later
+// check.
+func (sub *Subscription) NewEpisodes(info *extractor.TVSeriesInfo) []extractor.Episode {
+	var episodes []extractor.Episode
+	for _, ep := range info.Episodes() {
+		if len(ep.Links) > 0 && !sub.IsKnown(ep.ID) {
+			episodes = append(episodes, ep)
+		}
+	}
+	return episodes
+}
+
+// KnownIDs returns the IDs of every episode of a series that has links,
+// for marking a new subscription as up to date
+func KnownIDs(info *extractor.TVSeriesInfo) []string {
+	var ids []string
+	for _, ep := range info.Episodes() {
+		if len(ep.Links) > 0 {
+			ids = append(ids, ep.ID)
+		}
+	}
+	return ids
+}
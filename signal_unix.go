@@ -0,0 +1,40 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"tt6d/pkg/progress"
+	"tt6d/pkg/ratelimit"
+)
+
+// defaultSignalRate is used when SIGUSR1 first limits an unlimited download
+const defaultSignalRate = 1 << 20
+
+// watchRateSignals lets the bandwidth limit be changed while downloading:
+// SIGUSR1 halves the limit and SIGUSR2 doubles it.
+func watchRateSignals(limiter *ratelimit.Limiter, statusLine int) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range signals {
+			rate := limiter.Rate()
+			switch {
+			case sig == syscall.SIGUSR1 && rate == 0:
+				rate = defaultSignalRate
+			case sig == syscall.SIGUSR1:
+				rate = max(rate/2, 1024)
+			case sig == syscall.SIGUSR2 && rate == 0:
+				continue // already unlimited
+			case sig == syscall.SIGUSR2:
+				rate *= 2
+			}
+			limiter.SetRate(rate)
+			progress.PrintStatus(statusLine, "Rate limit: %s", ratelimit.FormatRate(rate))
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "tt6d/pkg/ratelimit"
+
+// watchRateSignals is a no-op on Windows, which has no SIGUSR1/SIGUSR2
+func watchRateSignals(limiter *ratelimit.Limiter, statusLine int) {}